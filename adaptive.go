@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// adaptiveCleanup holds the bounds set with WithAdaptiveCleanup, between
+// which the janitor adjusts its interval.
+type adaptiveCleanup struct {
+	min, max time.Duration
+}
+
+// clamp returns d limited to the bounds.
+func (a *adaptiveCleanup) clamp(d time.Duration) time.Duration {
+	if d < a.min {
+		return a.min
+	}
+	if d > a.max {
+		return a.max
+	}
+	return d
+}
+
+// next returns the interval to wait before the next sweep, given the current
+// interval and how many of the total items the last sweep deleted: half the
+// interval if more than a quarter of the items had expired, twice the
+// interval if none had, and the same interval otherwise.
+func (a *adaptiveCleanup) next(interval time.Duration, expired, total int) time.Duration {
+	switch {
+	case expired == 0:
+		interval *= 2
+	case expired > total/4:
+		interval /= 2
+	}
+	return a.clamp(interval)
+}
+
+// sweepCounting is sweep, but also returns how many items the cache held
+// before the sweep and how many of them it deleted because they expired, as
+// counted by Stats.
+func (c *cache[K, T]) sweepCounting() (expired, total int) {
+	total = c.ItemCount()
+	before := atomic.LoadUint64(&c.stats.expirations)
+	c.sweep()
+	after := atomic.LoadUint64(&c.stats.expirations)
+	if after < before {
+		// ResetStats was called during the sweep
+		return 0, total
+	}
+	return int(after - before), total
+}
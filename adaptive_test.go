@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveCleanupNext(t *testing.T) {
+	a := &adaptiveCleanup{time.Second, time.Minute}
+	assert.Equal(t, 20*time.Second, a.next(10*time.Second, 0, 100))
+	assert.Equal(t, time.Minute, a.next(40*time.Second, 0, 100))
+	assert.Equal(t, 10*time.Second, a.next(10*time.Second, 25, 100))
+	assert.Equal(t, 5*time.Second, a.next(10*time.Second, 26, 100))
+	assert.Equal(t, time.Second, a.next(time.Second, 100, 100))
+	assert.Equal(t, time.Second, a.clamp(time.Millisecond))
+}
+
+func TestWithAdaptiveCleanup(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, time.Hour, WithAdaptiveCleanup[string, int](time.Millisecond, 10*time.Millisecond))
+	defer tc.Close()
+	assert.Equal(t, 10*time.Millisecond, tc.janitor.Interval)
+	tc.Set("a", 1, time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return tc.ItemCount() == 0
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(1), tc.Stats().Expirations)
+
+	sc := NewSharded[string, int](DefaultExpiration, time.Hour, 2, nil, WithAdaptiveCleanup[string, int](time.Millisecond, 10*time.Millisecond))
+	defer sc.Close()
+	sc.Set("a", 1, time.Millisecond)
+	sc.Set("b", 2, time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return sc.ItemCount() == 0
+	}, time.Second, time.Millisecond)
+
+	assert.Nil(t, New[string, int](DefaultExpiration, 0, WithAdaptiveCleanup[string, int](time.Second, time.Millisecond)).adaptive)
+}
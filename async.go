@@ -0,0 +1,72 @@
+package cache
+
+import "sync"
+
+// dispatcher runs the eviction callbacks of a cache created with
+// WithAsyncCallbacks on a separate goroutine, one at a time and in the order
+// in which they were dispatched. The goroutine is started when a callback is
+// dispatched and exits once the queue is empty, so an idle cache doesn't keep
+// a goroutine around.
+type dispatcher struct {
+	mu      sync.Mutex
+	notFull *sync.Cond
+	queue   []func()
+	max     int
+	running bool
+}
+
+func newDispatcher(queueSize int) *dispatcher {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	d := &dispatcher{max: queueSize}
+	d.notFull = sync.NewCond(&d.mu)
+	return d
+}
+
+// dispatch queues f to be run by the dispatcher's goroutine, blocking while
+// the queue is full.
+func (d *dispatcher) dispatch(f func()) {
+	d.mu.Lock()
+	for len(d.queue) >= d.max {
+		d.notFull.Wait()
+	}
+	d.enqueueLocked(f)
+	d.mu.Unlock()
+}
+
+// enqueue queues f like dispatch, but never blocks, even if the queue is
+// full. It is used while holding the cache's lock, where waiting for a
+// callback that might need the lock could deadlock.
+func (d *dispatcher) enqueue(f func()) {
+	d.mu.Lock()
+	d.enqueueLocked(f)
+	d.mu.Unlock()
+}
+
+// enqueueLocked appends f to the queue and starts the goroutine if it isn't
+// running. d.mu must be held.
+func (d *dispatcher) enqueueLocked(f func()) {
+	d.queue = append(d.queue, f)
+	if !d.running {
+		d.running = true
+		go d.run()
+	}
+}
+
+func (d *dispatcher) run() {
+	for {
+		d.mu.Lock()
+		if len(d.queue) == 0 {
+			d.running = false
+			d.mu.Unlock()
+			return
+		}
+		f := d.queue[0]
+		d.queue[0] = nil
+		d.queue = d.queue[1:]
+		d.notFull.Broadcast()
+		d.mu.Unlock()
+		f()
+	}
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithAsyncCallbacks(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0, WithAsyncCallbacks[string, int](100))
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var evicted []string
+	done := make(chan struct{})
+	tc.OnEvicted(func(k string, v int) {
+		<-release
+		mu.Lock()
+		evicted = append(evicted, k)
+		n := len(evicted)
+		mu.Unlock()
+		if n == 10 {
+			close(done)
+		}
+	})
+	for i := 0; i < 10; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+
+	deleted := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			tc.Delete(strconv.Itoa(i))
+		}
+		close(deleted)
+	}()
+	select {
+	case <-deleted:
+	case <-time.After(time.Second):
+		t.Fatal("Delete waited for a slow callback")
+	}
+
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("callbacks didn't run")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i, k := range evicted {
+		assert.Equal(t, strconv.Itoa(i), k, "callbacks ran out of order")
+	}
+}
+
+func TestWithAsyncCallbacksQueueFull(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0, WithAsyncCallbacks[string, int](1))
+	release := make(chan struct{})
+	calls := make(chan string, 3)
+	tc.OnEvicted(func(k string, v int) {
+		<-release
+		calls <- k
+	})
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, DefaultExpiration)
+
+	deleted := make(chan struct{})
+	go func() {
+		tc.Delete("a") // running
+		tc.Delete("b") // queued
+		tc.Delete("c") // blocks until there is room
+		close(deleted)
+	}()
+	select {
+	case <-deleted:
+		t.Fatal("Delete didn't block on a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	<-deleted
+	for _, k := range []string{"a", "b", "c"} {
+		select {
+		case got := <-calls:
+			assert.Equal(t, k, got)
+		case <-time.After(time.Second):
+			t.Fatal("callback wasn't run")
+		}
+	}
+}
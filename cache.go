@@ -1,19 +1,37 @@
 package cache
 
 import (
+	"context"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/rand"
 	"os"
 	"reflect"
 	"runtime"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Item[T any] struct {
 	Object     T
 	Expiration int64
+	// ttl is the duration the item was stored with, used by GetSliding
+	ttl time.Duration
+	// version is the value of the cache's version counter when the item was
+	// stored, see GetVersioned
+	version uint64
+}
+
+// exported returns the item without the cache's bookkeeping in its unexported
+// fields, so that items handed out compare equal to Item{Object: x,
+// Expiration: e}.
+func (item Item[T]) exported() Item[T] {
+	return Item[T]{Object: item.Object, Expiration: item.Expiration}
 }
 
 // Expired Returns true if the item has expired.
@@ -24,6 +42,34 @@ func (item Item[T]) Expired() bool {
 	return time.Now().UnixNano() > item.Expiration
 }
 
+// ExpiresAt returns the time the item expires, or the zero time.Time if it
+// never expires.
+func (item Item[T]) ExpiresAt() time.Time {
+	if item.Expiration == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, item.Expiration)
+}
+
+// RemainingTTL returns how long the item has left until it expires, like the
+// cache's TTL method: NoExpiration if it never expires, and 0 if it has
+// expired. Like Expired, it uses the system clock rather than a Clock set
+// with WithClock.
+func (item Item[T]) RemainingTTL() time.Duration {
+	if item.Expiration == 0 {
+		return NoExpiration
+	}
+	now := time.Now().UnixNano()
+	if now > item.Expiration {
+		return 0
+	}
+	if now == item.Expiration {
+		// The item expires in less than a nanosecond
+		return 1
+	}
+	return time.Duration(item.Expiration - now)
+}
+
 const (
 	// NoExpiration For use with functions that take an expiration time.
 	NoExpiration time.Duration = -1
@@ -33,119 +79,915 @@ const (
 	DefaultExpiration time.Duration = 0
 )
 
+var (
+	// ErrKeyExists is returned (wrapped together with the key) when an item
+	// already exists for a key that must not have one, e.g. by Add.
+	ErrKeyExists = errors.New("item already exists")
+	// ErrKeyNotFound is returned (wrapped together with the key) when no
+	// unexpired item exists for a key that must have one, e.g. by Replace.
+	ErrKeyNotFound = errors.New("item not found")
+	// ErrTimeout is returned (wrapped together with the key) when waiting for
+	// another goroutine to compute an item takes too long, e.g. by
+	// GetOrComputeTimeout.
+	ErrTimeout = errors.New("timed out waiting for item")
+)
+
 type Cache[K comparable, T any] struct {
 	*cache[K, T]
 	// If this is confusing, see the comment at the bottom of New()
 }
 
 type cache[K comparable, T any] struct {
+	// stats is first so that its 64-bit counters are aligned for atomic
+	// access on 32-bit platforms.
+	stats stats
+	// defaultExpiration is accessed atomically, as it may be changed by
+	// SetDefaultExpiration while Set is computing an expiration time
+	// without holding mu. It follows stats to keep it 64-bit aligned.
 	defaultExpiration time.Duration
 	items             map[K]Item[T]
-	mu                sync.RWMutex
+	cleanups          map[K]func(T)
+	mu                cacheMutex
+	cow               *atomic.Value
 	onEvicted         func(K, T)
+	onExpired         func(K, T)
+	onEvictedReason   func(K, T, EvictReason)
+	events            *eventHub[K, T]
+	async             *dispatcher
+	observer          MetricsObserver[K]
+	onPanic           func(error)
+	negatives         map[K]int64
+	errs              map[K]cachedError
+	errorTTL          time.Duration
 	janitor           *janitor[K, T]
+	adaptive          *adaptiveCleanup
+	expireBatch       int
+	inspector         func(K, T) bool
+	validator         func(K, T) error
+	noJanitor         bool
+	expiredCh         chan KeyValue[K, T]
+	gobTypes          []any
+	capacity          int
+	closed            bool
+	maxItems          int
+	maxBytes          int64
+	sizer             func(K, T) int64
+	size              int64
+	clock             Clock
+	coarse            *CoarseClock
+	policy            EvictionPolicy[K]
+	newPolicy         func() EvictionPolicy[K]
+	flightMu          sync.Mutex
+	keyLocksOnce      sync.Once
+	keyLocks          *keyLocks[K]
+	flights           map[K]*call[T]
+	loader            func(K) (T, time.Duration, error)
+	loadLimit         *loadLimiter
+	maxJitter         time.Duration
+	jitterRand        *lockedRand
+	maxTTL            time.Duration
+	writeBehind       *writeBehind[K, T]
+	snapshot          *snapshotter[K, T]
+	heap              *heapWatcher[K, T]
+	refresh           *refreshAhead[K, T]
+	values            *valueCounts[T]
+	oplog             *opLog[K]
+	logReads          bool
+	// peak is the largest number of entries items has held. Go maps never
+	// shrink, so it approximates the map's capacity.
+	peak int
+	// version is incremented for every item that is stored, see
+	// GetVersioned.
+	version uint64
 }
 
 // Set an item to the cache, replacing any existing item. If the duration is 0
 // (DefaultExpiration), the cache's default expiration time is used. If it is -1
 // (NoExpiration), the item never expires.
 func (c *cache[K, T]) Set(k K, x T, d time.Duration) {
+	c.setWithCleanup(k, x, d, nil)
+}
+
+// SetWithCleanup is like Set, but also stores a cleanup function with the
+// item, which is called with the item's value after the eviction callbacks
+// whenever those are called for the item: when it is deleted (except by
+// GetAndDelete, which hands the value to the caller), expires and is deleted
+// by DeleteExpired, is overwritten by Set or SetMany, is evicted to make room,
+// or is flushed with FlushWithEvict. It is not called by Flush, nor when the
+// item is overwritten by Replace, Update, MutateInPlace, CompareAndSwap,
+// SetIfVersion, Merge or LoadMerge, or changed by Increment or Touch, which
+// keep it. This is useful for values that own resources such as files or
+// connections.
+func (c *cache[K, T]) SetWithCleanup(k K, x T, d time.Duration, cleanup func(T)) {
+	c.setWithCleanup(k, x, d, cleanup)
+}
+
+// SetValidated stores x under k like Set if the validator set with
+// WithValidator accepts it, and otherwise returns the validator's error
+// without storing x. Set itself can't report an error, so it doesn't call the
+// validator. The validator is called before the cache's lock is acquired.
+func (c *cache[K, T]) SetValidated(k K, x T, d time.Duration) error {
+	if err := c.validate(k, x); err != nil {
+		return err
+	}
+	c.Set(k, x, d)
+	return nil
+}
+
+// validate returns the error of the validator set with WithValidator for x,
+// or nil if there is no validator.
+func (c *cache[K, T]) validate(k K, x T) error {
+	if c.validator == nil {
+		return nil
+	}
+	return c.validator(k, x)
+}
+
+func (c *cache[K, T]) setWithCleanup(k K, x T, d time.Duration, cleanup func(T)) {
 	// "Inlining" of set
 	var e int64
-	if d == DefaultExpiration {
-		d = c.defaultExpiration
-	}
+	d = c.duration(d)
 	if d > 0 {
-		e = time.Now().Add(d).UnixNano()
+		e = c.now().Add(d + c.jitter()).UnixNano()
 	}
+	c.setItem(k, Item[T]{
+		Object:     x,
+		Expiration: e,
+		ttl:        d,
+	}, cleanup)
+}
+
+// setItem stores item under k like Set, with the given cleanup function,
+// acquiring the cache's lock.
+func (c *cache[K, T]) setItem(k K, item Item[T], cleanup func(T)) {
 	c.mu.Lock()
 	_, found := c.get(k)
 	if found {
-		v, evicted := c.delete(k)
-		c.items[k] = Item[T]{
-			Object:     x,
-			Expiration: e,
+		old, oldCleanup, _ := c.delete(k)
+		c.store(k, item)
+		c.setCleanup(k, cleanup)
+		var evicted []keyAndValue[K, T]
+		if c.policy != nil {
+			evicted = c.evictOverflow()
 		}
+		hooks := c.hooks()
 		c.mu.Unlock()
-		if evicted {
-			c.onEvicted(k, v)
-		}
+		hooks.fire(k, old.Object, Replaced, oldCleanup)
+		hooks.fireAll(evicted)
 		return
 	}
-	c.items[k] = Item[T]{
-		Object:     x,
-		Expiration: e,
+	c.store(k, item)
+	c.setCleanup(k, cleanup)
+	if c.policy != nil {
+		evicted := c.evictOverflow()
+		hooks := c.hooks()
+		c.mu.Unlock()
+		hooks.fireAll(evicted)
+		return
 	}
 	// TODO: Calls to mu.Unlock are currently not deferred because defer
 	// adds ~200 ns (as of go1.)
 	c.mu.Unlock()
 }
 
-func (c *cache[K, T]) set(k K, x T, d time.Duration) {
+// SetAbsolute stores x under k like Set, but the item expires exactly at the
+// given time rather than after a duration, or never if at is the zero
+// time.Time (subject to WithMaxTTL either way). Expiration jitter isn't
+// applied, and GetSliding never extends the item's expiration, so it can be
+// used for items that must not outlive a hard deadline in a cache whose other
+// items slide. If at has already passed, the item is stored expired.
+func (c *cache[K, T]) SetAbsolute(k K, x T, at time.Time) {
 	var e int64
-	if d == DefaultExpiration {
-		d = c.defaultExpiration
+	if !at.IsZero() {
+		e = at.UnixNano()
+		if e <= 0 {
+			// A time before 1970 has passed, but would mean "never"
+			e = 1
+		}
+	}
+	if c.maxTTL > 0 {
+		if max := c.now().Add(c.maxTTL).UnixNano(); e == 0 || e > max {
+			e = max
+		}
 	}
+	c.setItem(k, Item[T]{
+		Object:     x,
+		Expiration: e,
+	}, nil)
+}
+
+func (c *cache[K, T]) set(k K, x T, d time.Duration) {
+	var e int64
+	d = c.duration(d)
 	if d > 0 {
-		e = time.Now().Add(d).UnixNano()
+		e = c.now().Add(d + c.jitter()).UnixNano()
 	}
-	c.items[k] = Item[T]{
+	c.store(k, Item[T]{
 		Object:     x,
 		Expiration: e,
+		ttl:        d,
+	})
+}
+
+// store puts item into the cache under k, keeping the recency of use and size
+// bookkeeping up to date. The cleanup function of an unexpired item that is
+// overwritten is kept for the new item; that of an expired one is dropped.
+// c.mu must be held.
+func (c *cache[K, T]) store(k K, item Item[T]) {
+	if old, found := c.items[k]; found {
+		if c.cleanups != nil && c.expired(old) {
+			delete(c.cleanups, k)
+		}
+		c.unaccount(k, old.Object)
+	}
+	c.put(k, item)
+}
+
+// unaccount removes x, the value stored under k, from the size and value
+// counts. c.mu must be held.
+func (c *cache[K, T]) unaccount(k K, x T) {
+	if c.sizer != nil {
+		c.size -= c.sizer(k, x)
+	}
+	if c.values != nil {
+		c.values.remove(x)
 	}
 }
 
+// put is store for an item whose predecessor under k, if any, has already
+// been removed from the size and value counts with unaccount. c.mu must be
+// held.
+func (c *cache[K, T]) put(k K, item Item[T]) {
+	if c.sizer != nil {
+		c.size += c.sizer(k, item.Object)
+	}
+	if c.values != nil {
+		c.values.add(item.Object)
+	}
+	c.version++
+	item.version = c.version
+	c.items[k] = item
+	c.mu.changed = true
+	c.markDirty(k, item.Object)
+	c.logOp(OpSet, k)
+	if n := len(c.items); n > c.peak {
+		c.peak = n
+	}
+	if c.negatives != nil {
+		delete(c.negatives, k)
+	}
+	if c.errs != nil {
+		delete(c.errs, k)
+	}
+	if c.policy != nil {
+		c.policy.RecordInsert(k)
+	}
+	c.publish(Event[K, T]{EventSet, k, item.Object})
+}
+
+// overflows reports whether the cache holds more items, or more bytes, than
+// it is allowed to. c.mu must be held.
+func (c *cache[K, T]) overflows() bool {
+	return (c.maxItems > 0 && len(c.items) > c.maxItems) ||
+		(c.maxBytes > 0 && c.size > c.maxBytes)
+}
+
+// evictOverflow removes the least recently used items until the cache holds
+// no more than maxItems items and maxBytes bytes, and returns them. The most
+// recently used item is never evicted, even if it alone is larger than
+// maxBytes. c.mu must be held.
+func (c *cache[K, T]) evictOverflow() []keyAndValue[K, T] {
+	var evicted []keyAndValue[K, T]
+	for c.overflows() && len(c.items) > 1 {
+		k, ok := c.policy.Evict()
+		if !ok {
+			break
+		}
+		v, cleanup, _ := c.delete(k)
+		atomic.AddUint64(&c.stats.evictions, 1)
+		evicted = append(evicted, keyAndValue[K, T]{k, v.Object, CapacityEvicted, cleanup})
+	}
+	return evicted
+}
+
 // SetDefault an item to the cache, replacing any existing item, using the default
 // expiration.
 func (c *cache[K, T]) SetDefault(k K, x T) {
 	c.Set(k, x, DefaultExpiration)
 }
 
+// SetMany adds all of the given items to the cache, replacing any existing
+// items, with the same expiration duration d (see Set). The cache's lock is
+// only acquired once, which is cheaper than calling Set for each item. As
+// with Set, the OnEvicted function is called for each replaced item.
+func (c *cache[K, T]) SetMany(items map[K]T, d time.Duration) {
+	c.setEach(d, func(set func(K, T)) {
+		for k, x := range items {
+			set(k, x)
+		}
+	})
+}
+
+// ExpiringValue is a value together with the expiration duration to store it
+// with (see Set), as taken by SetManyWithExpiration.
+type ExpiringValue[T any] struct {
+	Value T
+	D     time.Duration
+}
+
+// SetManyWithExpiration is like SetMany, but stores each item with its own
+// expiration duration. As with Set, the OnEvicted function is called for
+// each replaced item.
+func (c *cache[K, T]) SetManyWithExpiration(items map[K]ExpiringValue[T]) {
+	c.setEachWithDuration(func(set func(K, T, time.Duration)) {
+		for k, v := range items {
+			set(k, v.Value, v.D)
+		}
+	})
+}
+
+// setEach stores every item passed to set by each with the duration d,
+// acquiring the cache's lock only once.
+func (c *cache[K, T]) setEach(d time.Duration, each func(set func(K, T))) {
+	c.setEachWithDuration(func(set func(K, T, time.Duration)) {
+		each(func(k K, x T) {
+			set(k, x, d)
+		})
+	})
+}
+
+// setEachWithDuration stores every item passed to set by each with the
+// duration passed with it, acquiring the cache's lock only once.
+func (c *cache[K, T]) setEachWithDuration(each func(set func(K, T, time.Duration))) {
+	now := c.now().UnixNano()
+	var evicted []keyAndValue[K, T]
+	c.mu.Lock()
+	each(func(k K, x T, d time.Duration) {
+		// "Inlining" of get
+		if ov, found := c.items[k]; found && (ov.Expiration <= 0 || now <= ov.Expiration) {
+			evicted = append(evicted, keyAndValue[K, T]{k, ov.Object, Replaced, c.cleanups[k]})
+		}
+		var e int64
+		d = c.duration(d)
+		if d > 0 {
+			e = now + int64(d+c.jitter())
+		}
+		c.store(k, Item[T]{
+			Object:     x,
+			Expiration: e,
+			ttl:        d,
+		})
+		c.setCleanup(k, nil)
+	})
+	if c.policy != nil {
+		evicted = append(evicted, c.evictOverflow()...)
+	}
+	hooks := c.hooks()
+	c.mu.Unlock()
+	hooks.fireAll(evicted)
+}
+
 // Add an item to the cache only if an item doesn't already exist for the given
-// key, or if the existing item has expired. Returns an error otherwise.
+// key, or if the existing item has expired. Returns an error wrapping
+// ErrKeyExists otherwise. If the cache was created with WithValidator, x is
+// validated first, and the validator's error is returned if it fails.
 func (c *cache[K, T]) Add(k K, x T, d time.Duration) error {
+	if err := c.validate(k, x); err != nil {
+		return err
+	}
 	c.mu.Lock()
 	_, found := c.get(k)
 	if found {
 		c.mu.Unlock()
-		return fmt.Errorf("item %v already exists", k)
+		return fmt.Errorf("%w: %v", ErrKeyExists, k)
 	}
 	c.set(k, x, d)
+	if c.policy != nil {
+		evicted := c.evictOverflow()
+		hooks := c.hooks()
+		c.mu.Unlock()
+		hooks.fireAll(evicted)
+		return nil
+	}
 	c.mu.Unlock()
 	return nil
 }
 
+// SetIfAbsent stores x under k with the duration d if no item exists for k or
+// the existing item has expired, and returns x and true. Otherwise it returns
+// the existing item and false, leaving it unchanged. It is like Add, but
+// returns the winning value instead of an error.
+func (c *cache[K, T]) SetIfAbsent(k K, x T, d time.Duration) (actual T, stored bool) {
+	c.mu.Lock()
+	if v, found := c.get(k); found {
+		if c.policy != nil {
+			c.policy.RecordAccess(k)
+		}
+		c.mu.Unlock()
+		return v, false
+	}
+	c.set(k, x, d)
+	if c.policy != nil {
+		evicted := c.evictOverflow()
+		hooks := c.hooks()
+		c.mu.Unlock()
+		hooks.fireAll(evicted)
+		return x, true
+	}
+	c.mu.Unlock()
+	return x, true
+}
+
+// SetNX stores x under k with the duration d if no item exists for k or the
+// existing item has expired, like Redis' SETNX. It returns whether x was
+// stored. It is like Add, but reports the outcome without creating an error.
+func (c *cache[K, T]) SetNX(k K, x T, d time.Duration) bool {
+	_, stored := c.SetIfAbsent(k, x, d)
+	return stored
+}
+
+// AddOrGet is like SetIfAbsent, but also returns the error Add would: if an
+// unexpired item exists for k, it returns that item, false and an error
+// wrapping ErrKeyExists, and otherwise it stores x and returns x, true and
+// nil. Like Add, it returns the error of a validator set with WithValidator
+// that rejects x, without storing x or returning the existing item.
+func (c *cache[K, T]) AddOrGet(k K, x T, d time.Duration) (T, bool, error) {
+	if err := c.validate(k, x); err != nil {
+		return *new(T), false, err
+	}
+	v, stored := c.SetIfAbsent(k, x, d)
+	if !stored {
+		return v, false, fmt.Errorf("%w: %v", ErrKeyExists, k)
+	}
+	return v, true, nil
+}
+
+// SetReturningOld stores x under k like Set, and returns the value it replaced
+// and whether there was one. An expired item that hasn't been deleted yet
+// counts as existing too, so its value is returned as well. Unlike Set, it
+// doesn't call the OnEvicted function or cleanup function for the replaced
+// value, which is handed to the caller instead.
+func (c *cache[K, T]) SetReturningOld(k K, x T, d time.Duration) (old T, existed bool) {
+	c.mu.Lock()
+	item, existed := c.items[k]
+	c.set(k, x, d)
+	c.setCleanup(k, nil)
+	var evicted []keyAndValue[K, T]
+	if c.policy != nil {
+		evicted = c.evictOverflow()
+	}
+	hooks := c.hooks()
+	c.mu.Unlock()
+	hooks.fireAll(evicted)
+	return item.Object, existed
+}
+
 // Replace a new value for the cache key only if it already exists, and the existing
-// item hasn't expired. Returns an error otherwise.
+// item hasn't expired. Returns an error wrapping ErrKeyNotFound otherwise. Like
+// Add, it returns the error of a validator set with WithValidator that rejects
+// x.
 func (c *cache[K, T]) Replace(k K, x T, d time.Duration) error {
+	if err := c.validate(k, x); err != nil {
+		return err
+	}
 	c.mu.Lock()
 	_, found := c.get(k)
 	if !found {
 		c.mu.Unlock()
-		return fmt.Errorf("item %v doesn't exist", k)
+		return fmt.Errorf("%w: %v", ErrKeyNotFound, k)
 	}
 	c.set(k, x, d)
+	var evicted []keyAndValue[K, T]
+	if c.policy != nil {
+		evicted = c.evictOverflow()
+	}
+	hooks := c.hooks()
 	c.mu.Unlock()
+	hooks.fireAll(evicted)
 	return nil
 }
 
+// Update atomically reads, modifies and writes the item for the given key.
+// fn is called with the current value and whether it was found (an expired
+// item counts as not found), and returns the new value and whether to store
+// it. If fn returns false, the cache is left unchanged. An existing item keeps
+// its expiration time; a new item gets the cache's default expiration time.
+// Returns the value returned by fn and whether it was stored.
+//
+// fn is called while the cache's write lock is held, so it must not call any
+// method of the cache, or Update deadlocks.
+func (c *cache[K, T]) Update(k K, fn func(old T, found bool) (T, bool)) (T, bool) {
+	c.mu.Lock()
+	item, found := c.items[k]
+	if found && c.expired(item) {
+		found = false
+	}
+	var old T
+	if found {
+		old = item.Object
+	}
+	x, ok := fn(old, found)
+	if !ok {
+		c.mu.Unlock()
+		return x, false
+	}
+	if found {
+		item.Object = x
+		c.store(k, item)
+	} else {
+		c.set(k, x, DefaultExpiration)
+	}
+	var evicted []keyAndValue[K, T]
+	if c.policy != nil {
+		evicted = c.evictOverflow()
+	}
+	hooks := c.hooks()
+	c.mu.Unlock()
+	hooks.fireAll(evicted)
+	return x, true
+}
+
+// MutateInPlace calls fn with a pointer to the value of the item for the
+// given key, if it exists and hasn't expired, so that fn can modify it in
+// place, e.g. by appending to a slice field of a struct or adding to a map,
+// and stores the result. The item keeps its expiration time. Returns whether
+// the item was found.
+//
+// fn is called while the cache's write lock is held, so the cache's methods
+// never return a partially modified value. Note that a map, slice or pointer
+// shared with a value returned by an earlier Get can still be read
+// concurrently by whoever holds that value. Since the lock is held, fn must
+// not call any method of the cache, or MutateInPlace deadlocks.
+func (c *cache[K, T]) MutateInPlace(k K, fn func(*T)) bool {
+	c.mu.Lock()
+	item, found := c.items[k]
+	if !found || c.expired(item) {
+		c.mu.Unlock()
+		return false
+	}
+	// The size and value counts must see the value as it was before fn,
+	// which may change data it shares with the stored item, such as a map
+	c.unaccount(k, item.Object)
+	fn(&item.Object)
+	c.put(k, item)
+	var evicted []keyAndValue[K, T]
+	if c.policy != nil {
+		evicted = c.evictOverflow()
+	}
+	hooks := c.hooks()
+	c.mu.Unlock()
+	hooks.fireAll(evicted)
+	return true
+}
+
+// Touch resets the expiration of an existing, unexpired item without changing
+// its value. d has the same meaning as for Set: DefaultExpiration uses the
+// cache's default expiration time and NoExpiration makes the item never
+// expire. Returns true if the item was found and touched, false otherwise.
+func (c *cache[K, T]) Touch(k K, d time.Duration) bool {
+	var e int64
+	d = c.duration(d)
+	if d > 0 {
+		e = c.now().Add(d).UnixNano()
+	}
+	c.mu.Lock()
+	item, found := c.items[k]
+	if !found || c.expired(item) {
+		c.mu.Unlock()
+		return false
+	}
+	item.Expiration = e
+	item.ttl = d
+	c.items[k] = item
+	c.mu.changed = true
+	c.mu.Unlock()
+	return true
+}
+
+// TouchMany resets the expiration of every existing, unexpired item for the
+// given keys like Touch, acquiring the cache's lock only once, and returns the
+// number of items that were touched. Missing and expired keys are skipped.
+func (c *cache[K, T]) TouchMany(keys []K, d time.Duration) int {
+	var e int64
+	d = c.duration(d)
+	if d > 0 {
+		e = c.now().Add(d).UnixNano()
+	}
+	n := 0
+	c.mu.Lock()
+	for _, k := range keys {
+		item, found := c.items[k]
+		if !found || c.expired(item) {
+			continue
+		}
+		item.Expiration = e
+		item.ttl = d
+		c.items[k] = item
+		c.mu.changed = true
+		n++
+	}
+	c.mu.Unlock()
+	return n
+}
+
+// ShiftExpirations adds delta to the expiration time of every unexpired item
+// that has one, under a single acquisition of the cache's write lock, e.g. to
+// pause expiration during maintenance and catch up afterwards. delta may be
+// negative, in which case items may expire at once. Items that never expire,
+// and those that have already expired, are left alone.
+func (c *cache[K, T]) ShiftExpirations(delta time.Duration) {
+	c.mu.Lock()
+	now := c.now().UnixNano()
+	for k, item := range c.items {
+		// "Inlining" of expired
+		if item.Expiration == 0 || now > item.Expiration {
+			continue
+		}
+		e := item.Expiration + int64(delta)
+		switch {
+		case delta > 0 && e < item.Expiration:
+			e = math.MaxInt64
+		case e <= 0:
+			// A time before 1970 has passed, but would mean "never"
+			e = 1
+		}
+		item.Expiration = e
+		c.items[k] = item
+		c.mu.changed = true
+	}
+	c.mu.Unlock()
+}
+
+// RenewOrSet resets the expiration of an existing, unexpired item like Touch,
+// leaving its value untouched, or stores x if there is no such item, using
+// the duration d either way (see Set). Returns true if an existing item was
+// renewed, and false if x was stored.
+func (c *cache[K, T]) RenewOrSet(k K, x T, d time.Duration) bool {
+	var e int64
+	d = c.duration(d)
+	if d > 0 {
+		e = c.now().Add(d + c.jitter()).UnixNano()
+	}
+	c.mu.Lock()
+	item, found := c.items[k]
+	if found && !c.expired(item) {
+		item.Expiration = e
+		item.ttl = d
+		c.items[k] = item
+		c.mu.changed = true
+		if c.policy != nil {
+			c.policy.RecordAccess(k)
+		}
+		c.mu.Unlock()
+		return true
+	}
+	c.store(k, Item[T]{
+		Object:     x,
+		Expiration: e,
+		ttl:        d,
+	})
+	var evicted []keyAndValue[K, T]
+	if c.policy != nil {
+		evicted = c.evictOverflow()
+	}
+	hooks := c.hooks()
+	c.mu.Unlock()
+	hooks.fireAll(evicted)
+	return false
+}
+
 // Get an item from the cache. Returns the item or nil, and a bool indicating
 // whether the key was found.
+//
+// If the cache was created with WithLoader and the item is missing or has
+// expired, Get loads it, stores it and returns it. Get returns false if the
+// loader fails.
 func (c *cache[K, T]) Get(k K) (T, bool) {
+	v, found := c.Peek(k)
+	if found || c.loader == nil {
+		return v, found
+	}
+	return c.loadThrough(context.Background(), k)
+}
+
+// GetContext is like Get, but if the item has to be loaded, waiting for the
+// load can be canceled with ctx: if ctx is done before the item has been
+// loaded, GetContext returns false, but other callers waiting for the same
+// load still get its result. A load that is still waiting for a slot of
+// WithLoaderConcurrency when every caller waiting for it has given up is
+// abandoned, and the loader isn't called; once the loader has been called,
+// its result is stored even if ctx is done.
+func (c *cache[K, T]) GetContext(ctx context.Context, k K) (T, bool) {
+	v, found := c.Peek(k)
+	if found || c.loader == nil {
+		return v, found
+	}
+	return c.loadThrough(ctx, k)
+}
+
+// Peek is like Get, but never calls the loader set with WithLoader.
+func (c *cache[K, T]) Peek(k K) (T, bool) {
+	if c.cow != nil {
+		return c.cowPeek(k)
+	}
+	if c.policy != nil {
+		return c.getAndTouch(k)
+	}
 	c.mu.RLock()
 	// "Inlining" of get and Expired
 	item, found := c.items[k]
 	if !found {
 		c.mu.RUnlock()
+		c.miss(k)
 		return *new(T), false
 	}
 	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
+		if c.now().UnixNano() > item.Expiration {
 			c.mu.RUnlock()
+			c.miss(k)
 			return *new(T), false
 		}
 	}
 	c.mu.RUnlock()
+	c.hit(k)
+	return item.Object, true
+}
+
+// Contains reports whether an unexpired item exists for the given key,
+// without copying its value. Unlike Get, it doesn't count towards Stats or
+// record the item's use for the eviction policy.
+func (c *cache[K, T]) Contains(k K) bool {
+	c.mu.RLock()
+	item, found := c.items[k]
+	c.mu.RUnlock()
+	return found && !c.expired(item)
+}
+
+// GetItem gets an item from the cache like Peek, but returns the whole Item,
+// whose Expiration, ExpiresAt and RemainingTTL tell when it expires. It
+// returns the zero Item and false if the item doesn't exist or has expired.
+func (c *cache[K, T]) GetItem(k K) (Item[T], bool) {
+	if c.policy != nil {
+		c.mu.Lock()
+	} else {
+		c.mu.RLock()
+	}
+	item, found := c.items[k]
+	found = found && !c.expired(item)
+	if found && c.policy != nil {
+		c.policy.RecordAccess(k)
+	}
+	if c.policy != nil {
+		c.mu.Unlock()
+	} else {
+		c.mu.RUnlock()
+	}
+	if !found {
+		c.miss(k)
+		return Item[T]{}, false
+	}
+	c.hit(k)
+	return item.exported(), true
+}
+
+// getAndTouch is Get for caches whose eviction policy tracks the use of their
+// items, which requires the write lock.
+func (c *cache[K, T]) getAndTouch(k K) (T, bool) {
+	c.mu.Lock()
+	v, found := c.get(k)
+	if found {
+		c.policy.RecordAccess(k)
+	}
+	c.mu.Unlock()
+	if found {
+		c.hit(k)
+	} else {
+		c.miss(k)
+	}
+	return v, found
+}
+
+// ItemView is a found item's value and expiration time, as returned by
+// GetManyWithExpiration.
+type ItemView[T any] struct {
+	Value T
+	// Expiration is the time the item expires, or the zero time.Time if it
+	// never expires.
+	Expiration time.Time
+}
+
+// GetMany gets the items for all of the given keys from the cache, acquiring
+// the cache's lock only once. The returned map only contains the keys that
+// were found and haven't expired.
+func (c *cache[K, T]) GetMany(keys []K) map[K]T {
+	m := make(map[K]T, len(keys))
+	c.getMany(keys, func(k K, item Item[T]) {
+		m[k] = item.Object
+	})
+	return m
+}
+
+// GetManyWithExpiration is like GetMany, but also returns the expiration time
+// of every item, like GetWithExpiration.
+func (c *cache[K, T]) GetManyWithExpiration(keys []K) map[K]ItemView[T] {
+	m := make(map[K]ItemView[T], len(keys))
+	c.getMany(keys, func(k K, item Item[T]) {
+		v := ItemView[T]{Value: item.Object}
+		if item.Expiration > 0 {
+			v.Expiration = time.Unix(0, item.Expiration)
+		}
+		m[k] = v
+	})
+	return m
+}
+
+// getMany calls found with every unexpired item stored under one of keys,
+// holding the cache's lock, and records the hits and misses.
+func (c *cache[K, T]) getMany(keys []K, found func(K, Item[T])) {
+	var hit []bool
+	if c.observer != nil || (c.oplog != nil && c.logReads) {
+		hit = make([]bool, len(keys))
+	}
+	hits := 0
+	now := c.now().UnixNano()
+	if c.policy != nil {
+		c.mu.Lock()
+	} else {
+		c.mu.RLock()
+	}
+	for i, k := range keys {
+		item, ok := c.items[k]
+		// "Inlining" of Expired
+		if !ok || (item.Expiration > 0 && now > item.Expiration) {
+			continue
+		}
+		found(k, item)
+		hits++
+		if hit != nil {
+			hit[i] = true
+		}
+		if c.policy != nil {
+			c.policy.RecordAccess(k)
+		}
+	}
+	if c.policy != nil {
+		c.mu.Unlock()
+	} else {
+		c.mu.RUnlock()
+	}
+	atomic.AddUint64(&c.stats.hits, uint64(hits))
+	atomic.AddUint64(&c.stats.misses, uint64(len(keys)-hits))
+	if hit == nil {
+		return
+	}
+	for i, k := range keys {
+		c.logRead(k, hit[i])
+		if c.observer == nil {
+			continue
+		}
+		if hit[i] {
+			c.observer.OnHit(k)
+		} else {
+			c.observer.OnMiss(k)
+		}
+	}
+}
+
+// GetSliding gets an item from the cache like Get, and if it is found, resets
+// its expiration to now plus the duration it was stored with, so that items
+// which keep being read stay in the cache (a sliding expiration window).
+// Items that never expire, and items that have already expired, are left
+// untouched; an expired item is never revived. Items added via NewFrom() or
+// Load() don't carry their original duration and therefore don't slide,
+// and neither do items stored with SetAbsolute.
+//
+// Unlike Get, GetSliding takes the cache's write lock.
+func (c *cache[K, T]) GetSliding(k K) (T, bool) {
+	c.mu.Lock()
+	item, found := c.items[k]
+	if !found {
+		c.mu.Unlock()
+		c.miss(k)
+		return *new(T), false
+	}
+	if item.Expiration > 0 {
+		now := c.now().UnixNano()
+		if now > item.Expiration {
+			c.mu.Unlock()
+			c.miss(k)
+			return *new(T), false
+		}
+		if item.ttl > 0 {
+			item.Expiration = now + int64(item.ttl)
+			c.items[k] = item
+			c.mu.changed = true
+		}
+	}
+	if c.policy != nil {
+		c.policy.RecordAccess(k)
+	}
+	c.mu.Unlock()
+	c.hit(k)
 	return item.Object, true
 }
 
@@ -163,7 +1005,7 @@ func (c *cache[K, T]) GetWithExpiration(k K) (T, time.Time, bool) {
 	}
 
 	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
+		if c.now().UnixNano() > item.Expiration {
 			c.mu.RUnlock()
 			return *new(T), time.Time{}, false
 		}
@@ -179,6 +1021,114 @@ func (c *cache[K, T]) GetWithExpiration(k K) (T, time.Time, bool) {
 	return item.Object, time.Time{}, true
 }
 
+// TTL returns how long the item stored under k has left until it expires, and
+// a bool indicating whether the key was found. For an unexpired item the
+// returned duration is always positive. For an item that never expires, TTL
+// returns NoExpiration (which is negative). If no unexpired item exists, TTL
+// returns 0 and false.
+func (c *cache[K, T]) TTL(k K) (time.Duration, bool) {
+	c.mu.RLock()
+	item, found := c.items[k]
+	c.mu.RUnlock()
+	if !found {
+		return 0, false
+	}
+	if item.Expiration <= 0 {
+		return NoExpiration, true
+	}
+	now := c.now().UnixNano()
+	if now > item.Expiration {
+		return 0, false
+	}
+	if now == item.Expiration {
+		// The item expires in less than a nanosecond
+		return 1, true
+	}
+	return time.Duration(item.Expiration - now), true
+}
+
+// GetStale returns an item from the cache even if it has expired, as long as
+// it hasn't been deleted yet (e.g. by the janitor or DeleteExpired). It
+// returns the item or nil, a bool indicating whether the item has expired,
+// and a bool indicating whether the key was found. This allows serving a stale
+// value while a fresh one is loaded. The item is left as it is; an expired
+// item is not revived.
+func (c *cache[K, T]) GetStale(k K) (value T, expired bool, found bool) {
+	c.mu.RLock()
+	item, found := c.items[k]
+	if !found {
+		c.mu.RUnlock()
+		return *new(T), false, false
+	}
+	expired = c.expired(item)
+	c.mu.RUnlock()
+	return item.Object, expired, true
+}
+
+// now returns the current time according to the cache's clock.
+func (c *cache[K, T]) now() time.Time {
+	return c.clock.Now()
+}
+
+// duration resolves a duration passed to Set or a similar method to the
+// duration the item is stored with, applying the default expiration and the
+// limit set by WithMaxTTL.
+func (c *cache[K, T]) duration(d time.Duration) time.Duration {
+	if d == DefaultExpiration {
+		d = time.Duration(atomic.LoadInt64((*int64)(&c.defaultExpiration)))
+	}
+	if c.maxTTL > 0 && (d <= 0 || d > c.maxTTL) {
+		d = c.maxTTL
+	}
+	return d
+}
+
+// DefaultExpiration returns the duration that items stored with
+// DefaultExpiration are stored with. It returns NoExpiration if those items
+// never expire.
+func (c *cache[K, T]) DefaultExpiration() time.Duration {
+	return time.Duration(atomic.LoadInt64((*int64)(&c.defaultExpiration)))
+}
+
+// SetDefaultExpiration changes the duration that items subsequently stored
+// with DefaultExpiration are stored with. As with New(), a duration of less
+// than one (or NoExpiration) means those items never expire. Items already in
+// the cache keep their expiration times.
+func (c *cache[K, T]) SetDefaultExpiration(d time.Duration) {
+	if d == 0 {
+		d = -1
+	}
+	atomic.StoreInt64((*int64)(&c.defaultExpiration), int64(d))
+}
+
+// jitter returns a random duration in [0, maxJitter] to add to a new item's
+// expiration time, or 0 if WithExpirationJitter wasn't used.
+func (c *cache[K, T]) jitter() time.Duration {
+	if c.maxJitter <= 0 {
+		return 0
+	}
+	return time.Duration(c.jitterRand.Int63n(int64(c.maxJitter) + 1))
+}
+
+// lockedRand is a *rand.Rand that is safe for concurrent use, as it may be
+// shared by all shards of a ShardedCache.
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func (l *lockedRand) Int63n(n int64) int64 {
+	l.mu.Lock()
+	x := l.r.Int63n(n)
+	l.mu.Unlock()
+	return x
+}
+
+// expired is Item.Expired according to the cache's clock.
+func (c *cache[K, T]) expired(item Item[T]) bool {
+	return item.Expiration > 0 && c.now().UnixNano() > item.Expiration
+}
+
 func (c *cache[K, T]) get(k K) (T, bool) {
 	item, found := c.items[k]
 	if !found {
@@ -186,7 +1136,7 @@ func (c *cache[K, T]) get(k K) (T, bool) {
 	}
 	// "Inlining" of Expired
 	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
+		if c.now().UnixNano() > item.Expiration {
 			return *new(T), false
 		}
 	}
@@ -196,80 +1146,390 @@ func (c *cache[K, T]) get(k K) (T, bool) {
 // Delete an item from the cache. Does nothing if the key is not in the cache.
 func (c *cache[K, T]) Delete(k K) {
 	c.mu.Lock()
-	v, evicted := c.delete(k)
+	v, cleanup, found := c.delete(k)
+	c.forgetDirty(k)
+	hooks := c.hooks()
+	c.mu.Unlock()
+	if found {
+		atomic.AddUint64(&c.stats.evictions, 1)
+		hooks.fire(k, v.Object, Deleted, cleanup)
+	}
+}
+
+// GetAndDelete atomically gets an item from the cache and deletes it. Returns
+// the item or nil, and a bool indicating whether the key was found. Expired
+// items are not returned (nor deleted). As with Delete, the OnEvicted
+// function is called for the deleted item.
+func (c *cache[K, T]) GetAndDelete(k K) (T, bool) {
+	c.mu.Lock()
+	if _, found := c.get(k); !found {
+		c.mu.Unlock()
+		return *new(T), false
+	}
+	v, _, _ := c.delete(k)
+	c.forgetDirty(k)
+	hooks := c.hooks()
+	c.mu.Unlock()
+	atomic.AddUint64(&c.stats.evictions, 1)
+	// The value now belongs to the caller, so its cleanup isn't called
+	hooks.fire(k, v.Object, Deleted, nil)
+	return v.Object, true
+}
+
+// Rename atomically moves the item stored under the key from to the key to,
+// keeping its value, expiration and cleanup function, and returns true. If to
+// already holds an unexpired item, that item is replaced, and the OnEvicted
+// function is called for it as for Set; no callbacks are called for the moved
+// item. Rename returns false, and does nothing, if from doesn't exist or has
+// expired.
+func (c *cache[K, T]) Rename(from, to K) bool {
+	c.mu.Lock()
+	if _, found := c.get(from); !found {
+		c.mu.Unlock()
+		return false
+	}
+	if from == to {
+		c.mu.Unlock()
+		return true
+	}
+	item, cleanup, _ := c.delete(from)
+	c.forgetDirty(from)
+	c.publish(Event[K, T]{EventDelete, from, item.Object})
+	_, clobbered := c.get(to)
+	prev, prevCleanup, _ := c.delete(to)
+	c.store(to, item)
+	c.setCleanup(to, cleanup)
+	var evicted []keyAndValue[K, T]
+	if c.policy != nil {
+		evicted = c.evictOverflow()
+	}
+	hooks := c.hooks()
+	c.mu.Unlock()
+	if clobbered {
+		hooks.fire(to, prev.Object, Replaced, prevCleanup)
+	}
+	hooks.fireAll(evicted)
+	return true
+}
+
+// PopN atomically deletes up to n arbitrary unexpired items from the cache and
+// returns them. It returns fewer than n items if the cache holds fewer
+// unexpired ones. Which items are popped is unspecified. As with
+// GetAndDelete, the OnEvicted function is called for each deleted item, but
+// their cleanup functions aren't, as the values now belong to the caller.
+func (c *cache[K, T]) PopN(n int) map[K]T {
+	popped := make(map[K]T)
+	if n <= 0 {
+		return popped
+	}
+	now := c.now().UnixNano()
+	var evicted []keyAndValue[K, T]
+	c.mu.Lock()
+	hooks := c.hooks()
+	for k, v := range c.items {
+		if len(popped) == n {
+			break
+		}
+		// "Inlining" of expired
+		if v.Expiration > 0 && now > v.Expiration {
+			continue
+		}
+		c.delete(k)
+		c.forgetDirty(k)
+		popped[k] = v.Object
+		if hooks.isSet() {
+			evicted = append(evicted, keyAndValue[K, T]{k, v.Object, Deleted, nil})
+		}
+	}
+	c.mu.Unlock()
+	atomic.AddUint64(&c.stats.evictions, uint64(len(popped)))
+	hooks.fireAll(evicted)
+	return popped
+}
+
+// delete removes k from the cache and returns its item, its cleanup function
+// and whether it was present. c.mu must be held.
+func (c *cache[K, T]) delete(k K) (Item[T], func(T), bool) {
+	if v, found := c.items[k]; found {
+		delete(c.items, k)
+		c.mu.changed = true
+		cleanup := c.cleanups[k]
+		if cleanup != nil {
+			delete(c.cleanups, k)
+		}
+		c.logOp(OpDelete, k)
+		if c.policy != nil {
+			c.policy.Remove(k)
+		}
+		c.unaccount(k, v.Object)
+		return v, cleanup, true
+	}
+	return Item[T]{}, nil, false
+}
+
+// setCleanup sets the cleanup function of the item stored under k, or removes
+// it if cleanup is nil. Cleanup functions are kept in c.cleanups rather than
+// in the items, so that Item stays comparable. c.mu must be held.
+func (c *cache[K, T]) setCleanup(k K, cleanup func(T)) {
+	if cleanup == nil {
+		if c.cleanups != nil {
+			delete(c.cleanups, k)
+		}
+		return
+	}
+	if c.cleanups == nil {
+		c.cleanups = make(map[K]func(T))
+	}
+	c.cleanups[k] = cleanup
+}
+
+type keyAndValue[K comparable, T any] struct {
+	key     K
+	value   T
+	reason  EvictReason
+	cleanup func(T)
+}
+
+// DeleteFunc deletes every unexpired item for which pred returns true and
+// returns the number of items deleted. pred is called under the cache's write
+// lock, so it must not call methods on the cache. The eviction callbacks are
+// run for each deleted item after the lock has been released.
+func (c *cache[K, T]) DeleteFunc(pred func(k K, v T) bool) int {
+	var evictedItems []keyAndValue[K, T]
+	n := 0
+	c.mu.Lock()
+	hooks := c.hooks()
+	now := c.now().UnixNano()
+	for k, v := range c.items {
+		if v.Expiration > 0 && now > v.Expiration {
+			continue
+		}
+		if !pred(k, v.Object) {
+			continue
+		}
+		_, cleanup, _ := c.delete(k)
+		c.forgetDirty(k)
+		n++
+		if hooks.isSet() || cleanup != nil {
+			evictedItems = append(evictedItems, keyAndValue[K, T]{k, v.Object, Deleted, cleanup})
+		}
+	}
+	c.mu.Unlock()
+	atomic.AddUint64(&c.stats.evictions, uint64(n))
+	hooks.fireAll(evictedItems)
+	return n
+}
+
+// DeleteExpired Deletes all expired items from the cache.
+func (c *cache[K, T]) DeleteExpired() {
+	if c.expireBatch > 0 || c.inspector != nil {
+		c.deleteExpiredUnlocked()
+		return
+	}
+	var evictedItems []keyAndValue[K, T]
+	now := c.now().UnixNano()
+	var expired uint64
+	c.mu.Lock()
+	hooks := c.hooks()
+	for k, v := range c.items {
+		// "Inlining" of expired
+		if v.Expiration > 0 && now > v.Expiration {
+			_, cleanup, _ := c.delete(k)
+			c.sendExpired(k, v.Object)
+			expired++
+			if hooks.isSet() || cleanup != nil {
+				evictedItems = append(evictedItems, keyAndValue[K, T]{k, v.Object, Expired, cleanup})
+			}
+		}
+	}
+	c.deleteExpiredNegatives(now)
+	c.deleteExpiredErrors(now)
+	c.mu.Unlock()
+	atomic.AddUint64(&c.stats.expirations, expired)
+	hooks.fireAll(evictedItems)
+}
+
+// deleteExpiredUnlocked is DeleteExpired for caches created with
+// WithExpirationBatchSize or WithExpiryInspector. It collects the expired
+// items under the read lock, passes them to the inspector without holding the
+// lock, and then deletes those the inspector let go, holding the write lock
+// for at most c.expireBatch items at a time.
+func (c *cache[K, T]) deleteExpiredUnlocked() {
+	now := c.now().UnixNano()
+	var candidates []KeyValue[K, Item[T]]
+	c.mu.RLock()
+	for k, v := range c.items {
+		// "Inlining" of expired
+		if v.Expiration > 0 && now > v.Expiration {
+			candidates = append(candidates, KeyValue[K, Item[T]]{k, v})
+		}
+	}
+	c.mu.RUnlock()
+	if c.inspector != nil {
+		kept := candidates[:0]
+		for _, kv := range candidates {
+			if c.inspector(kv.Key, kv.Value.Object) {
+				kept = append(kept, kv)
+			}
+		}
+		candidates = kept
+	}
+	batch := c.expireBatch
+	if batch <= 0 {
+		batch = len(candidates)
+	}
+	for len(candidates) > 0 {
+		n := batch
+		if n > len(candidates) {
+			n = len(candidates)
+		}
+		var evictedItems []keyAndValue[K, T]
+		var expired uint64
+		c.mu.Lock()
+		hooks := c.hooks()
+		for _, kv := range candidates[:n] {
+			// The item may have been replaced or touched since it was seen.
+			k := kv.Key
+			v, found := c.items[k]
+			if !found || v.version != kv.Value.version || v.Expiration != kv.Value.Expiration {
+				continue
+			}
+			_, cleanup, _ := c.delete(k)
+			c.sendExpired(k, v.Object)
+			expired++
+			if hooks.isSet() || cleanup != nil {
+				evictedItems = append(evictedItems, keyAndValue[K, T]{k, v.Object, Expired, cleanup})
+			}
+		}
+		c.mu.Unlock()
+		atomic.AddUint64(&c.stats.expirations, expired)
+		hooks.fireAll(evictedItems)
+		candidates = candidates[n:]
+	}
+	c.mu.Lock()
+	c.deleteExpiredNegatives(now)
+	c.deleteExpiredErrors(now)
 	c.mu.Unlock()
-	if evicted {
-		c.onEvicted(k, v)
-	}
 }
 
-func (c *cache[K, T]) delete(k K) (T, bool) {
-	if c.onEvicted != nil {
-		if v, found := c.items[k]; found {
-			delete(c.items, k)
-			return v.Object, true
-		}
+// sendExpired sends the expired item x stored under k on the channel returned
+// by ExpirationChannel, if there is one, without blocking. c.mu must be held.
+func (c *cache[K, T]) sendExpired(k K, x T) {
+	if c.expiredCh == nil || c.closed {
+		return
+	}
+	select {
+	case c.expiredCh <- KeyValue[K, T]{k, x}:
+	default:
+		atomic.AddUint64(&c.stats.droppedExpirations, 1)
 	}
-	delete(c.items, k)
-	return *new(T), false
 }
 
-type keyAndValue[K comparable, T any] struct {
-	key   K
-	value T
+// ExpirationChannel returns the channel on which DeleteExpired (and so the
+// janitor) sends the items it deletes, for a cache created with
+// WithExpirationChannel, or nil otherwise. The channel is closed when the
+// cache is closed.
+func (c *cache[K, T]) ExpirationChannel() <-chan KeyValue[K, T] {
+	return c.expiredCh
 }
 
-// DeleteExpired Deletes all expired items from the cache.
-func (c *cache[K, T]) DeleteExpired() {
-	var evictedItems []keyAndValue[K, T]
-	now := time.Now().UnixNano()
+// OnEvicted sets an (optional) function that is called with the key and value when an
+// item is evicted from the cache. (Including when it is deleted manually, and
+// when its value is overwritten by Set, SetMany or another method that replaces
+// the whole item, but not when it is changed by Replace, Update, Increment or
+// another method that keeps the item; see SetWithCleanup.) It is called after
+// the cache's lock has been released. Set to nil to disable.
+func (c *cache[K, T]) OnEvicted(f func(K, T)) {
 	c.mu.Lock()
-	for k, v := range c.items {
-		// "Inlining" of expired
-		if v.Expiration > 0 && now > v.Expiration {
-			ov, evicted := c.delete(k)
-			if evicted {
-				evictedItems = append(evictedItems, keyAndValue[K, T]{k, ov})
-			}
-		}
-	}
+	c.onEvicted = f
 	c.mu.Unlock()
-	for _, v := range evictedItems {
-		c.onEvicted(v.key, v.value)
-	}
 }
 
-// OnEvicted sets an (optional) function that is called with the key and value when an
-// item is evicted from the cache. (Including when it is deleted manually, but
-// not when it is overwritten.) Set to nil to disable.
-func (c *cache[K, T]) OnEvicted(f func(K, T)) {
+// OnExpired sets an (optional) function that is called with the key and value
+// when an expired item is deleted from the cache by DeleteExpired (or the
+// janitor). It is never called for items that are deleted manually. If it is
+// set, it is called instead of the OnEvicted function for expired items, so
+// the two can be told apart; if it is nil, expired items are reported to the
+// OnEvicted function as before. Set to nil to disable.
+func (c *cache[K, T]) OnExpired(f func(K, T)) {
 	c.mu.Lock()
-	c.onEvicted = f
+	c.onExpired = f
+	c.mu.Unlock()
+}
+
+// RegisterTypes records values whose concrete types Save and Load register
+// with gob (see gob.Register) before encoding or decoding the cache's items.
+//
+// This matters when T is an interface type: gob can only encode and decode a
+// value held in an interface if its concrete type has been registered, and
+// Save otherwise only registers the types of the items the cache holds when it
+// is called. Registering every type the cache may hold up front means a blob
+// can be decoded even by a cache that hasn't stored a value of each type yet,
+// and saving doesn't depend on which values happen to be cached. Types are
+// registered under their names, so the saving and the loading program must
+// register the same types, and a type must not be registered under two
+// names.
+func (c *cache[K, T]) RegisterTypes(values ...any) {
+	c.mu.Lock()
+	c.gobTypes = append(c.gobTypes, values...)
 	c.mu.Unlock()
 }
 
-// Save writes the cache's items (using Gob) to an io.Writer.
+// registerGobTypes registers the types recorded by RegisterTypes with gob.
+// c.mu must be held.
+func (c *cache[K, T]) registerGobTypes() {
+	for _, v := range c.gobTypes {
+		gob.Register(v)
+	}
+}
+
+// Save writes the cache's items (using Gob) to an io.Writer. The types
+// recorded with RegisterTypes, and those of the items in the cache, are
+// registered with gob first.
+//
+// The items are copied while holding the cache's read lock, and encoded and
+// written after it has been released, so that writers aren't blocked for as
+// long as a large cache takes to encode, or a slow Writer to accept it. The
+// copy takes memory for as many items as the cache holds. The items saved are
+// those the cache held at one instant, but values that are pointers, maps or
+// slices are shared with the cache, and changes made to them while they're
+// being encoded may be saved in part.
 //
 // NOTE: This method is deprecated in favor of c.Items() and NewFrom() (see the
 // documentation for NewFrom().)
 func (c *cache[K, T]) Save(w io.Writer) (err error) {
-	enc := gob.NewEncoder(w)
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	return c.save(w, false)
+}
 
-	var t T
-	switch reflect.TypeOf(t).Kind() {
+// save is Save, leaving out the expired items if unexpiredOnly is true.
+func (c *cache[K, T]) save(w io.Writer, unexpiredOnly bool) error {
+	// TypeOf of a zero T would be nil if T is an interface type
+	switch reflect.TypeOf(new(T)).Elem().Kind() {
 	case reflect.Func:
 		return fmt.Errorf("can't encode functions")
 	case reflect.Chan:
 		return fmt.Errorf("can't encode channels")
 	}
 
-	for _, v := range c.items {
+	now := c.now().UnixNano()
+	c.mu.RLock()
+	items := make(map[K]Item[T], len(c.items))
+	for k, v := range c.items {
+		// "Inlining" of expired
+		if unexpiredOnly && v.Expiration > 0 && now > v.Expiration {
+			continue
+		}
+		items[k] = v
+	}
+	types := append([]any(nil), c.gobTypes...)
+	c.mu.RUnlock()
+	for _, v := range types {
+		gob.Register(v)
+	}
+	for _, v := range items {
 		gob.Register(v.Object)
 	}
-	err = enc.Encode(&c.items)
-	return err
+	return gob.NewEncoder(w).Encode(&items)
 }
 
 // SaveFile saves the cache's items to the given filename, creating the file if it
@@ -296,20 +1556,50 @@ func (c *cache[K, T]) SaveFile(fname string) error {
 // NOTE: This method is deprecated in favor of c.Items() and NewFrom() (see the
 // documentation for NewFrom().)
 func (c *cache[K, T]) Load(r io.Reader) error {
+	return c.LoadMerge(r, nil)
+}
+
+// LoadMerge adds (Gob-serialized) cache items from an io.Reader like Load, but
+// for a key that already holds an unexpired item, it calls resolve with the
+// existing and the incoming item and stores the item it returns, so that it
+// can keep either one (e.g. the one that expires last) or combine them. If
+// resolve is nil, existing items are kept, as Load does. resolve is called
+// while the cache's write lock is held, so it must not call any method of
+// the cache.
+func (c *cache[K, T]) LoadMerge(r io.Reader, resolve func(existing, incoming Item[T]) Item[T]) error {
+	c.mu.RLock()
+	c.registerGobTypes()
+	c.mu.RUnlock()
 	dec := gob.NewDecoder(r)
 	items := map[K]Item[T]{}
 	err := dec.Decode(&items)
 	if err == nil {
-		c.mu.Lock()
-		defer c.mu.Unlock()
-		for k, v := range items {
-			ov, found := c.items[k]
-			if !found || ov.Expired() {
-				c.items[k] = v
+		c.load(items, resolve)
+	}
+	return err
+}
+
+// load adds items to the cache. For keys that already hold an unexpired item,
+// the item returned by resolve is stored, or, if resolve is nil, the existing
+// item is kept.
+func (c *cache[K, T]) load(items map[K]Item[T], resolve func(existing, incoming Item[T]) Item[T]) {
+	var evicted []keyAndValue[K, T]
+	c.mu.Lock()
+	for k, v := range items {
+		if ov, found := c.items[k]; found && !c.expired(ov) {
+			if resolve == nil {
+				continue
 			}
+			v = resolve(ov.exported(), v.exported())
 		}
+		c.store(k, v)
 	}
-	return err
+	if c.policy != nil {
+		evicted = c.evictOverflow()
+	}
+	hooks := c.hooks()
+	c.mu.Unlock()
+	hooks.fireAll(evicted)
 }
 
 // LoadFile loads and add cache items from the given filename, excluding any items with
@@ -335,7 +1625,7 @@ func (c *cache[K, T]) Items() map[K]Item[T] {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	m := make(map[K]Item[T], len(c.items))
-	now := time.Now().UnixNano()
+	now := c.now().UnixNano()
 	for k, v := range c.items {
 		// "Inlining" of Expired
 		if v.Expiration > 0 {
@@ -343,11 +1633,197 @@ func (c *cache[K, T]) Items() map[K]Item[T] {
 				continue
 			}
 		}
-		m[k] = v
+		m[k] = v.exported()
+	}
+	return m
+}
+
+// ItemEntry is an item with its key, as returned by ExportSorted.
+type ItemEntry[K comparable, T any] struct {
+	Key   K
+	Value T
+	// Expiration is the time the item expires, or the zero time.Time if it
+	// never expires.
+	Expiration time.Time
+}
+
+// ExportSorted returns all unexpired items in the cache as a slice sorted by
+// their keys, as ordered by less. Unlike the map returned by Items, whose
+// iteration order is random, the result is the same for the same items, e.g.
+// for golden files in tests. The items are copied while holding the cache's
+// read lock, and sorted after it has been released.
+func (c *cache[K, T]) ExportSorted(less func(a, b K) bool) []ItemEntry[K, T] {
+	now := c.now().UnixNano()
+	c.mu.RLock()
+	entries := make([]ItemEntry[K, T], 0, len(c.items))
+	for k, v := range c.items {
+		// "Inlining" of expired
+		if v.Expiration > 0 && now > v.Expiration {
+			continue
+		}
+		entries = append(entries, ItemEntry[K, T]{k, v.Object, v.ExpiresAt()})
+	}
+	c.mu.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return less(entries[i].Key, entries[j].Key)
+	})
+	return entries
+}
+
+// ItemsIncludingExpired copies all items in the cache into a new map and
+// returns it, including items that have expired but haven't been deleted yet.
+// Unlike with Items(), callers must check Item.Expired() themselves to tell
+// live items from expired ones.
+func (c *cache[K, T]) ItemsIncludingExpired() map[K]Item[T] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m := make(map[K]Item[T], len(c.items))
+	for k, v := range c.items {
+		m[k] = v.exported()
 	}
 	return m
 }
 
+// Keys returns the keys of all unexpired items in the cache, in no particular
+// order. The returned slice is a snapshot: it is freshly allocated, and may be
+// stale as soon as it is returned.
+func (c *cache[K, T]) Keys() []K {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	keys := make([]K, 0, len(c.items))
+	now := c.now().UnixNano()
+	for k, v := range c.items {
+		// "Inlining" of Expired
+		if v.Expiration > 0 {
+			if now > v.Expiration {
+				continue
+			}
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// OldestN returns the keys of up to n unexpired items, ordered by how soon
+// they expire: the item that expires first comes first, and items that never
+// expire come last. Items with the same expiration time are returned in no
+// particular order. OldestN sorts a snapshot of the cache's items on every
+// call, so it takes O(m log m) time for a cache with m items.
+func (c *cache[K, T]) OldestN(n int) []K {
+	if n <= 0 {
+		return nil
+	}
+	type keyAndExpiration struct {
+		key        K
+		expiration int64
+	}
+	c.mu.RLock()
+	entries := make([]keyAndExpiration, 0, len(c.items))
+	now := c.now().UnixNano()
+	for k, v := range c.items {
+		// "Inlining" of Expired
+		if v.Expiration > 0 && now > v.Expiration {
+			continue
+		}
+		entries = append(entries, keyAndExpiration{k, v.Expiration})
+	}
+	c.mu.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		ei, ej := entries[i].expiration, entries[j].expiration
+		if ei <= 0 || ej <= 0 {
+			return ej <= 0 && ei > 0
+		}
+		return ei < ej
+	})
+	if n > len(entries) {
+		n = len(entries)
+	}
+	keys := make([]K, n)
+	for i := range keys {
+		keys[i] = entries[i].key
+	}
+	return keys
+}
+
+// Range calls fn for each unexpired item in the cache, in no particular
+// order, without copying the cache's items. If fn returns false, Range stops
+// the iteration.
+//
+// fn is called while the cache's read lock is held, so it must not call any
+// method that modifies the cache (e.g. Set or Delete), or Range deadlocks.
+func (c *cache[K, T]) Range(fn func(k K, v T) bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.now().UnixNano()
+	for k, v := range c.items {
+		// "Inlining" of Expired
+		if v.Expiration > 0 {
+			if now > v.Expiration {
+				continue
+			}
+		}
+		if !fn(k, v.Object) {
+			return
+		}
+	}
+}
+
+// GroupBy returns the values of all unexpired items in the cache, grouped by
+// the string keyFn returns for each item. The values in a group are in no
+// particular order.
+//
+// keyFn is called while the cache's read lock is held, so it must not call
+// any method that modifies the cache (e.g. Set or Delete), or GroupBy
+// deadlocks.
+func (c *cache[K, T]) GroupBy(keyFn func(K, T) string) map[string][]T {
+	groups := make(map[string][]T)
+	c.Range(func(k K, v T) bool {
+		g := keyFn(k, v)
+		groups[g] = append(groups[g], v)
+		return true
+	})
+	return groups
+}
+
+// ExpirationHistogram counts the unexpired items in the cache by how long
+// they have left until they expire. Each item is counted under the smallest
+// duration in buckets that is at least its remaining TTL, items that outlive
+// every bucket are counted under time.Duration(math.MaxInt64), and items that
+// never expire are counted under NoExpiration. buckets need not be sorted.
+// Every bucket is present in the result, even if no items fall into it.
+//
+// All items are counted at the same instant, while holding the cache's read
+// lock for O(n log b) time, where b is the number of buckets.
+func (c *cache[K, T]) ExpirationHistogram(buckets []time.Duration) map[time.Duration]int {
+	bounds := make([]time.Duration, len(buckets))
+	copy(bounds, buckets)
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+	hist := make(map[time.Duration]int, len(bounds)+2)
+	for _, b := range bounds {
+		hist[b] = 0
+	}
+	c.mu.RLock()
+	now := c.now().UnixNano()
+	for _, v := range c.items {
+		if v.Expiration == 0 {
+			hist[NoExpiration]++
+			continue
+		}
+		if now > v.Expiration {
+			continue
+		}
+		ttl := time.Duration(v.Expiration - now)
+		i := sort.Search(len(bounds), func(i int) bool { return bounds[i] >= ttl })
+		if i == len(bounds) {
+			hist[time.Duration(math.MaxInt64)]++
+		} else {
+			hist[bounds[i]]++
+		}
+	}
+	c.mu.RUnlock()
+	return hist
+}
+
 // ItemCount returns the number of items in the cache. This may include items that have
 // expired, but have not yet been cleaned up.
 func (c *cache[K, T]) ItemCount() int {
@@ -357,24 +1833,247 @@ func (c *cache[K, T]) ItemCount() int {
 	return n
 }
 
+// CountUnexpired returns the number of items in the cache that haven't
+// expired. Unlike ItemCount, which is O(1), it has to check every item, so it
+// takes O(n) time while holding the cache's read lock. In return it gives an
+// accurate count that doesn't depend on when expired items were last deleted.
+func (c *cache[K, T]) CountUnexpired() int {
+	c.mu.RLock()
+	n := 0
+	now := c.now().UnixNano()
+	for _, v := range c.items {
+		// "Inlining" of Expired
+		if v.Expiration <= 0 || now <= v.Expiration {
+			n++
+		}
+	}
+	c.mu.RUnlock()
+	return n
+}
+
+// ExpiredCount returns the number of items in the cache that have expired but
+// haven't been deleted yet, in O(n) time while holding the cache's read lock,
+// like CountUnexpired. If it is often high relative to ItemCount, the cleanup
+// interval is too long for how quickly items expire.
+func (c *cache[K, T]) ExpiredCount() int {
+	c.mu.RLock()
+	n := 0
+	now := c.now().UnixNano()
+	for _, v := range c.items {
+		// "Inlining" of Expired
+		if v.Expiration > 0 && now > v.Expiration {
+			n++
+		}
+	}
+	c.mu.RUnlock()
+	return n
+}
+
+// Cap returns the largest number of items the cache's underlying map has held
+// since the cache was created (counting the items passed to NewFrom) or last
+// flushed. Go maps don't release memory when items are deleted, so unlike
+// ItemCount, which reports the current number of items, Cap approximates the
+// size the map has been allocated for. It can be used to monitor memory use,
+// or to size the map passed to NewFrom when restoring a snapshot.
+func (c *cache[K, T]) Cap() int {
+	c.mu.RLock()
+	n := c.peak
+	c.mu.RUnlock()
+	return n
+}
+
+// Compact deletes the expired items like DeleteExpired, and then copies the
+// remaining items into a new map, holding the cache's write lock for O(n)
+// time, so that the memory the old map allocated for many more items can be
+// reclaimed, e.g. after deleting most of the items. It returns the size of
+// the map before and after, as Cap would report it.
+func (c *cache[K, T]) Compact() (before, after int) {
+	c.DeleteExpired()
+	c.mu.Lock()
+	items := make(map[K]Item[T], len(c.items))
+	for k, v := range c.items {
+		items[k] = v
+	}
+	c.items = items
+	before = c.peak
+	c.peak = len(items)
+	c.mu.Unlock()
+	return before, len(items)
+}
+
 // Flush deletes all items from the cache.
 func (c *cache[K, T]) Flush() {
 	c.mu.Lock()
 	c.items = map[K]Item[T]{}
+	c.mu.changed = true
+	c.cleanups = nil
+	if c.policy != nil {
+		c.policy = c.newPolicy()
+	}
+	c.size = 0
+	c.peak = 0
+	c.negatives = nil
+	c.errs = nil
+	if c.writeBehind != nil {
+		c.writeBehind.dirty = make(map[K]T)
+	}
+	if c.values != nil {
+		c.values.reset()
+	}
+	c.logOp(OpFlush, *new(K))
+	c.mu.Unlock()
+}
+
+// FlushWithEvict deletes all items from the cache like Flush, but also calls
+// the OnEvicted function (or, for expired items, the OnExpired function) for
+// each of them, so that any cleanup done by those functions runs. The items
+// are collected while holding the cache's lock, and the functions are called
+// after it has been released.
+func (c *cache[K, T]) FlushWithEvict() {
+	now := c.now().UnixNano()
+	c.mu.Lock()
+	evicted := make([]keyAndValue[K, T], 0, len(c.items))
+	for k, v := range c.items {
+		reason := Deleted
+		// "Inlining" of expired
+		if v.Expiration > 0 && now > v.Expiration {
+			reason = Expired
+		}
+		evicted = append(evicted, keyAndValue[K, T]{k, v.Object, reason, c.cleanups[k]})
+	}
+	c.items = map[K]Item[T]{}
+	c.mu.changed = true
+	c.cleanups = nil
+	if c.policy != nil {
+		c.policy = c.newPolicy()
+	}
+	c.size = 0
+	c.peak = 0
+	c.negatives = nil
+	c.errs = nil
+	if c.writeBehind != nil {
+		c.writeBehind.dirty = make(map[K]T)
+	}
+	if c.values != nil {
+		c.values.reset()
+	}
+	c.logOp(OpFlush, *new(K))
+	hooks := c.hooks()
+	c.mu.Unlock()
+	hooks.fireAll(evicted)
+}
+
+// adopt makes items the cache's items, giving them versions and recomputing
+// the size and value counts. c.mu must be held, unless c is being created.
+func (c *cache[K, T]) adopt(items map[K]Item[T]) {
+	c.items = items
+	c.mu.changed = true
+	c.size = 0
+	if c.values != nil {
+		c.values.reset()
+	}
+	for k, v := range items {
+		c.version++
+		v.version = c.version
+		items[k] = v
+		if c.sizer != nil {
+			c.size += c.sizer(k, v.Object)
+		}
+		if c.values != nil {
+			c.values.add(v.Object)
+		}
+	}
+}
+
+// SwapItems replaces all items in the cache with items, and returns the map
+// that held the previous ones, so that a fresh set of items can be built
+// without holding the cache's lock and put in place at once. As with NewFrom,
+// the cache uses items directly, so it shouldn't be used by the caller
+// afterwards. The items count as stored, getting new versions (see
+// GetVersioned) and evicting items to keep the cache within its limits, but
+// not as written for WithWriteBehind, and, like Flush, SwapItems produces no
+// events and forgets negative entries and cached errors.
+//
+// If evict is true, the OnEvicted function (or, for expired items, the
+// OnExpired function) and any cleanup function set with SetWithCleanup are
+// called for every previous item whose key isn't in items, after the cache's
+// lock has been released, as FlushWithEvict does.
+func (c *cache[K, T]) SwapItems(items map[K]Item[T], evict bool) map[K]Item[T] {
+	if items == nil {
+		items = map[K]Item[T]{}
+	}
+	now := c.now().UnixNano()
+	c.mu.Lock()
+	old, oldCleanups := c.items, c.cleanups
+	c.cleanups = nil
+	c.adopt(items)
+	c.logOp(OpFlush, *new(K))
+	c.peak = len(items)
+	c.negatives = nil
+	c.errs = nil
+	if c.writeBehind != nil {
+		c.writeBehind.dirty = make(map[K]T)
+	}
+	var evicted []keyAndValue[K, T]
+	if evict {
+		for k, v := range old {
+			if _, found := items[k]; found {
+				continue
+			}
+			reason := Deleted
+			// "Inlining" of expired
+			if v.Expiration > 0 && now > v.Expiration {
+				reason = Expired
+			}
+			evicted = append(evicted, keyAndValue[K, T]{k, v.Object, reason, oldCleanups[k]})
+		}
+	}
+	if c.policy != nil {
+		c.policy = c.newPolicy()
+		for k := range items {
+			c.policy.RecordInsert(k)
+		}
+		evicted = append(evicted, c.evictOverflow()...)
+	}
+	hooks := c.hooks()
 	c.mu.Unlock()
+	hooks.fireAll(evicted)
+	for k, v := range old {
+		old[k] = v.exported()
+	}
+	return old
 }
 
 type janitor[K comparable, T any] struct {
 	Interval time.Duration
 	stop     chan bool
+	stopOnce sync.Once
+}
+
+// Stop signals the janitor goroutine to exit. The stop channel is closed
+// rather than sent on, so Stop never blocks and may safely be called more
+// than once (e.g. by both Close and the finalizer).
+func (j *janitor[K, T]) Stop() {
+	j.stopOnce.Do(func() {
+		close(j.stop)
+	})
 }
 
 func (j *janitor[K, T]) Run(c *cache[K, T]) {
 	ticker := time.NewTicker(j.Interval)
+	interval := j.Interval
 	for {
 		select {
 		case <-ticker.C:
-			c.DeleteExpired()
+			if c.adaptive == nil {
+				c.sweep()
+				continue
+			}
+			expired, total := c.sweepCounting()
+			if d := c.adaptive.next(interval, expired, total); d != interval {
+				interval = d
+				ticker.Reset(interval)
+			}
 		case <-j.stop:
 			ticker.Stop()
 			return
@@ -382,11 +2081,117 @@ func (j *janitor[K, T]) Run(c *cache[K, T]) {
 	}
 }
 
+// finalizeCache stops the goroutines started for c once c is unreachable.
+func finalizeCache[K comparable, T any](c *Cache[K, T]) {
+	stopJanitor(c)
+	c.stopWorkers(false)
+}
+
+// hasWorkers reports whether options such as WithWriteBehind started
+// goroutines for c, which the janitor doesn't account for.
+func (c *cache[K, T]) hasWorkers() bool {
+	return c.writeBehind != nil || c.snapshot != nil || c.coarse != nil ||
+		c.heap != nil
+}
+
+// stopWorkers stops the goroutines started for c by its options, waiting for
+// their final flush or save if wait is true.
+func (c *cache[K, T]) stopWorkers(wait bool) {
+	c.mu.Lock()
+	w := c.writeBehind
+	c.writeBehind = nil
+	s := c.snapshot
+	c.snapshot = nil
+	cc := c.coarse
+	c.coarse = nil
+	h := c.heap
+	c.heap = nil
+	c.mu.Unlock()
+	if cc != nil {
+		cc.Stop()
+	}
+	if h != nil {
+		h.stop(wait)
+	}
+	if w != nil {
+		w.stop(wait)
+	}
+	if s != nil {
+		s.stop(wait)
+	}
+}
+
 func stopJanitor[K comparable, T any](c *Cache[K, T]) {
-	c.janitor.stop <- true
+	if j := c.janitor; j != nil {
+		j.Stop()
+	}
+}
+
+// Close stops the janitor goroutine (if one was started) and clears the
+// finalizer set by New() and NewFrom(), so the goroutine doesn't linger until
+// the next garbage collection. The goroutines started by WithWriteBehind and
+// WithPeriodicSnapshot are stopped too, after a final flush or snapshot,
+// which Close waits for. Close is idempotent. The cache remains safe to
+// use after it has been closed, but expired items are no longer deleted
+// automatically; call c.DeleteExpired() to remove them.
+func (c *Cache[K, T]) Close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	if c.expiredCh != nil {
+		close(c.expiredCh)
+	}
+	j := c.janitor
+	c.janitor = nil
+	c.mu.Unlock()
+	runtime.SetFinalizer(c, nil)
+	if j != nil {
+		j.Stop()
+	}
+	c.stopWorkers(true)
+}
+
+// SetCleanupInterval changes the interval at which the janitor deletes
+// expired items from the cache, starting the janitor if none was running. If
+// d is less than one, the janitor is stopped and expired items are no longer
+// deleted automatically. Calling it on a closed cache, or one created with
+// WithoutJanitor, does nothing.
+func (c *Cache[K, T]) SetCleanupInterval(d time.Duration) {
+	c.mu.Lock()
+	if c.closed || c.noJanitor {
+		c.mu.Unlock()
+		return
+	}
+	old := c.janitor
+	c.janitor = nil
+	if d > 0 {
+		runJanitor(c.cache, d)
+	}
+	running := c.janitor != nil
+	working := c.hasWorkers()
+	c.mu.Unlock()
+	// The old janitor may be waiting for the lock in DeleteExpired, so it
+	// must only be stopped after the lock has been released.
+	if old != nil {
+		old.Stop()
+	}
+	// A cache with workers already has its finalizer, and setting it twice
+	// is a fatal error
+	switch {
+	case old == nil && running && !working:
+		runtime.SetFinalizer(c, finalizeCache[K, T])
+	case old != nil && !running && !working:
+		runtime.SetFinalizer(c, nil)
+	}
 }
 
 func runJanitor[K comparable, T any](c *cache[K, T], ci time.Duration) {
+	if c.adaptive != nil {
+		ci = c.adaptive.clamp(ci)
+	}
 	j := &janitor[K, T]{
 		Interval: ci,
 		stop:     make(chan bool),
@@ -395,28 +2200,66 @@ func runJanitor[K comparable, T any](c *cache[K, T], ci time.Duration) {
 	go j.Run(c)
 }
 
-func newCache[K comparable, T any](de time.Duration, m map[K]Item[T]) *cache[K, T] {
+func newCache[K comparable, T any](de time.Duration, m map[K]Item[T], opts ...Option[K, T]) *cache[K, T] {
 	if de == 0 {
 		de = -1
 	}
 	c := &cache[K, T]{
 		defaultExpiration: de,
 		items:             m,
+		clock:             realClock{},
+		peak:              len(m),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.capacity > 0 && len(m) == 0 {
+		c.items = make(map[K]Item[T], c.capacity)
+	}
+	c.adopt(c.items)
+	if c.cow != nil {
+		c.publishItems()
+	}
+	if c.maxItems > 0 || c.maxBytes > 0 {
+		if c.newPolicy == nil {
+			c.policy = newLRU[K](len(m))
+			c.newPolicy = NewLRUPolicy[K]
+		} else {
+			c.policy = c.newPolicy()
+		}
+		for k := range m {
+			c.policy.RecordInsert(k)
+		}
+		c.evictOverflow()
+	}
+	if c.writeBehind != nil {
+		go c.writeBehind.run(c)
+	}
+	if c.snapshot != nil {
+		go c.snapshot.run(c)
+	}
+	if c.heap != nil {
+		go c.heap.run(c)
 	}
 	return c
 }
 
-func newCacheWithJanitor[K comparable, T any](de time.Duration, ci time.Duration, m map[K]Item[T]) *Cache[K, T] {
-	c := newCache[K, T](de, m)
+func newCacheWithJanitor[K comparable, T any](de time.Duration, ci time.Duration, m map[K]Item[T], opts ...Option[K, T]) *Cache[K, T] {
+	c := newCache[K, T](de, m, opts...)
 	// This trick ensures that the janitor goroutine (which--granted it
 	// was enabled--is running DeleteExpired on c forever) does not keep
 	// the returned C object from being garbage collected. When it is
 	// garbage collected, the finalizer stops the janitor goroutine, after
 	// which c can be collected.
 	C := &Cache[K, T]{c}
+	if c.noJanitor {
+		ci = 0
+	}
 	if ci > 0 {
 		runJanitor(c, ci)
-		runtime.SetFinalizer(C, stopJanitor[K, T])
+	}
+	if ci > 0 || c.hasWorkers() {
+		runtime.SetFinalizer(C, finalizeCache[K, T])
 	}
 	return C
 }
@@ -425,10 +2268,23 @@ func newCacheWithJanitor[K comparable, T any](de time.Duration, ci time.Duration
 // interval. If the expiration duration is less than one (or NoExpiration),
 // the items in the cache never expire (by default), and must be deleted
 // manually. If the cleanup interval is less than one, expired items are not
-// deleted from the cache before calling c.DeleteExpired().
-func New[K comparable, T any](defaultExpiration, cleanupInterval time.Duration) *Cache[K, T] {
+// deleted from the cache before calling c.DeleteExpired(). Optional behavior
+// can be configured by passing options such as WithMaxItems.
+func New[K comparable, T any](defaultExpiration, cleanupInterval time.Duration, opts ...Option[K, T]) *Cache[K, T] {
 	items := make(map[K]Item[T])
-	return newCacheWithJanitor[K, T](defaultExpiration, cleanupInterval, items)
+	return newCacheWithJanitor[K, T](defaultExpiration, cleanupInterval, items, opts...)
+}
+
+// NewStringKeyed returns a new cache with string keys, like
+// New[string, T](defaultExpiration, cleanupInterval, opts...).
+func NewStringKeyed[T any](defaultExpiration, cleanupInterval time.Duration, opts ...Option[string, T]) *Cache[string, T] {
+	return New[string, T](defaultExpiration, cleanupInterval, opts...)
+}
+
+// NewIntKeyed returns a new cache with int keys, like
+// New[int, T](defaultExpiration, cleanupInterval, opts...).
+func NewIntKeyed[T any](defaultExpiration, cleanupInterval time.Duration, opts ...Option[int, T]) *Cache[int, T] {
+	return New[int, T](defaultExpiration, cleanupInterval, opts...)
 }
 
 // NewFrom returns a new cache with a given default expiration duration and cleanup
@@ -438,10 +2294,10 @@ func New[K comparable, T any](defaultExpiration, cleanupInterval time.Duration)
 // deleted from the cache before calling c.DeleteExpired().
 //
 // NewFrom() also accepts an items map which will serve as the underlying map
-// for the cache. This is useful for starting from a deserialized cache
-// (serialized using e.g. gob.Encode() on c.Items()), or passing in e.g.
-// make(map[K]Item, 500) to improve startup performance when the cache
-// is expected to reach a certain minimum size.
+// for the cache; it is used as is, not copied. This is useful for starting
+// from a deserialized cache (serialized using e.g. gob.Encode() on
+// c.Items()), or passing in e.g. make(map[K]Item, 500) to improve startup
+// performance when the cache is expected to reach a certain minimum size.
 //
 // Only the cache's methods synchronize access to this map, so it is not
 // recommended to keep any references to the map around after creating a cache.
@@ -452,6 +2308,6 @@ func New[K comparable, T any](defaultExpiration, cleanupInterval time.Duration)
 // gob.Register() the individual types stored in the cache before encoding a
 // map retrieved with c.Items(), and to register those same types before
 // decoding a blob containing an items map.
-func NewFrom[K comparable, T any](defaultExpiration, cleanupInterval time.Duration, items map[K]Item[T]) *Cache[K, T] {
-	return newCacheWithJanitor(defaultExpiration, cleanupInterval, items)
+func NewFrom[K comparable, T any](defaultExpiration, cleanupInterval time.Duration, items map[K]Item[T], opts ...Option[K, T]) *Cache[K, T] {
+	return newCacheWithJanitor(defaultExpiration, cleanupInterval, items, opts...)
 }
@@ -2,10 +2,14 @@ package cache
 
 import (
 	"bytes"
+	"errors"
+	"math"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -151,6 +155,76 @@ func TestAdd(t *testing.T) {
 	if err == nil {
 		t.Error("Successfully added another foo when it should have returned an error")
 	}
+	assert.ErrorIs(t, err, ErrKeyExists)
+	assert.Contains(t, err.Error(), "foo")
+}
+
+func TestSetIfAbsent(t *testing.T) {
+	tc := New[string, string](DefaultExpiration, 0)
+	v, stored := tc.SetIfAbsent("foo", "bar", DefaultExpiration)
+	assert.True(t, stored)
+	assert.Equal(t, "bar", v)
+
+	v, stored = tc.SetIfAbsent("foo", "baz", DefaultExpiration)
+	assert.False(t, stored)
+	assert.Equal(t, "bar", v)
+	x, _ := tc.Get("foo")
+	assert.Equal(t, "bar", x)
+
+	tc.Set("expired", "old", time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+	v, stored = tc.SetIfAbsent("expired", "new", DefaultExpiration)
+	assert.True(t, stored)
+	assert.Equal(t, "new", v)
+}
+
+func TestWithCapacity(t *testing.T) {
+	tc := New[int, int](DefaultExpiration, 0, WithCapacity[int, int](100))
+	for i := 0; i < 200; i++ {
+		tc.Set(i, i, DefaultExpiration)
+	}
+	assert.Equal(t, 200, tc.ItemCount())
+
+	items := map[int]Item[int]{1: {Object: 1}}
+	tc = NewFrom[int, int](DefaultExpiration, 0, items, WithCapacity[int, int](100))
+	x, found := tc.Get(1)
+	assert.True(t, found, "WithCapacity replaced the map passed to NewFrom")
+	assert.Equal(t, 1, x)
+}
+
+func TestTouchMany(t *testing.T) {
+	clock := NewFakeClock(time.Date(2022, 6, 16, 0, 0, 0, 0, time.UTC))
+	tc := New[string, int](DefaultExpiration, 0, WithClock[string, int](clock))
+	tc.Set("expired", 3, time.Second)
+	clock.Advance(2 * time.Second)
+	tc.Set("a", 1, time.Second)
+	tc.Set("b", 2, time.Second)
+	assert.Equal(t, 2, tc.TouchMany([]string{"a", "b", "expired", "missing"}, time.Hour))
+	clock.Advance(2 * time.Second)
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, tc.GetMany([]string{"a", "b", "expired"}))
+}
+
+func TestSetNX(t *testing.T) {
+	tc := New[string, string](DefaultExpiration, 0)
+	assert.True(t, tc.SetNX("lock", "a", time.Millisecond))
+	assert.False(t, tc.SetNX("lock", "b", DefaultExpiration))
+	x, _ := tc.Get("lock")
+	assert.Equal(t, "a", x)
+	<-time.After(2 * time.Millisecond)
+	assert.True(t, tc.SetNX("lock", "b", DefaultExpiration), "expired item wasn't replaced")
+}
+
+func TestAddOrGet(t *testing.T) {
+	tc := New[string, string](DefaultExpiration, 0)
+	v, added, err := tc.AddOrGet("foo", "bar", DefaultExpiration)
+	assert.NoError(t, err)
+	assert.True(t, added)
+	assert.Equal(t, "bar", v)
+
+	v, added, err = tc.AddOrGet("foo", "baz", DefaultExpiration)
+	assert.ErrorIs(t, err, ErrKeyExists)
+	assert.False(t, added)
+	assert.Equal(t, "bar", v)
 }
 
 func TestReplace(t *testing.T) {
@@ -159,6 +233,8 @@ func TestReplace(t *testing.T) {
 	if err == nil {
 		t.Error("Replaced foo when it shouldn't exist")
 	}
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.Contains(t, err.Error(), "foo")
 	tc.Set("foo", "bar", DefaultExpiration)
 	err = tc.Replace("foo", "bar", DefaultExpiration)
 	if err != nil {
@@ -234,6 +310,34 @@ func TestOnEvicted(t *testing.T) {
 	}
 }
 
+func TestLoadMerge(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("a", 1, time.Minute)
+	tc.Set("b", 2, time.Hour)
+	tc.Set("new", 3, DefaultExpiration)
+	fp := &bytes.Buffer{}
+	assert.NoError(t, tc.Save(fp))
+	data := fp.Bytes()
+
+	oc := New[string, int](DefaultExpiration, 0)
+	oc.Set("a", 10, time.Hour)
+	oc.Set("b", 20, time.Minute)
+	keepLater := func(existing, incoming Item[int]) Item[int] {
+		if incoming.Expiration > existing.Expiration {
+			return incoming
+		}
+		return existing
+	}
+	assert.NoError(t, oc.LoadMerge(bytes.NewReader(data), keepLater))
+	assert.Equal(t, map[string]int{"a": 10, "b": 2, "new": 3}, oc.GetMany([]string{"a", "b", "new"}))
+
+	oc = New[string, int](DefaultExpiration, 0)
+	oc.Set("a", 10, time.Hour)
+	assert.NoError(t, oc.LoadMerge(bytes.NewReader(data), nil))
+	x, _ := oc.Get("a")
+	assert.Equal(t, 10, x, "existing item was replaced without a resolver")
+}
+
 func TestCacheSerialization(t *testing.T) {
 	tc := New[string, TestStruct](DefaultExpiration, 0)
 	testFillAndSerialize(t, tc)
@@ -243,6 +347,31 @@ func TestCacheSerialization(t *testing.T) {
 	testFillAndSerialize(t, tc)
 }
 
+type testShape interface {
+	Area() int
+}
+
+type testSquare struct{ Side int }
+
+func (s testSquare) Area() int { return s.Side * s.Side }
+
+func TestRegisterTypes(t *testing.T) {
+	tc := New[string, testShape](DefaultExpiration, 0)
+	tc.RegisterTypes(testSquare{})
+	fp := &bytes.Buffer{}
+	assert.NoError(t, tc.Save(fp), "saving an empty cache")
+
+	tc.Set("a", testSquare{3}, DefaultExpiration)
+	fp.Reset()
+	assert.NoError(t, tc.Save(fp))
+	oc := New[string, testShape](DefaultExpiration, 0)
+	oc.RegisterTypes(testSquare{})
+	assert.NoError(t, oc.Load(fp))
+	x, found := oc.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, 9, x.Area())
+}
+
 func testFillAndSerialize(t *testing.T, tc *Cache[string, TestStruct]) {
 
 	tc.Set("*struct", TestStruct{Num: 1}, DefaultExpiration)
@@ -344,6 +473,31 @@ func TestFileSerialization(t *testing.T) {
 	}
 }
 
+// writerFunc is an io.Writer that calls a function.
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestSaveWithoutLock(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	buf := &bytes.Buffer{}
+	// The writer would deadlock if Save held the lock while writing
+	err := tc.Save(writerFunc(func(p []byte) (int, error) {
+		tc.Set("c", 3, DefaultExpiration)
+		return buf.Write(p)
+	}))
+	assert.NoError(t, err)
+
+	oc := New[string, int](DefaultExpiration, 0)
+	assert.NoError(t, oc.Load(buf))
+	assert.Equal(t, 2, oc.ItemCount())
+	assert.False(t, oc.Contains("c"))
+}
+
 func TestSerializeUnserializable(t *testing.T) {
 	tc := New[string, chan bool](DefaultExpiration, 0)
 	ch := make(chan bool, 1)
@@ -712,3 +866,1038 @@ func BenchmarkCacheGetFatStructNotExpiring(b *testing.B) {
 		st.Num++
 	}
 }
+
+func TestClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+	tc := New[string, int](DefaultExpiration, 1*time.Millisecond)
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Close()
+	tc.Close() // must not block on a second stop
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		<-time.After(time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before, "janitor goroutine is still running after Close")
+
+	tc.Set("bar", 2, DefaultExpiration)
+	x, found := tc.Get("bar")
+	assert.True(t, found)
+	assert.Equal(t, 2, x)
+	tc.Delete("bar")
+	_, found = tc.Get("bar")
+	assert.False(t, found)
+}
+
+func TestCloseWithoutJanitor(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Close()
+	tc.Close()
+}
+
+func TestStopJanitorTwice(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, time.Millisecond)
+	j := tc.janitor
+	done := make(chan struct{})
+	go func() {
+		// Simulates the finalizer and an explicit stop both firing.
+		stopJanitor(tc)
+		stopJanitor(tc)
+		j.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stopping the janitor twice blocked")
+	}
+	tc.Close()
+}
+
+func TestDeleteFunc(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	var evicted []string
+	tc.OnEvicted(func(k string, v int) {
+		evicted = append(evicted, k)
+	})
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, DefaultExpiration)
+	tc.Set("d", 4, DefaultExpiration)
+	tc.Set("e", 6, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+
+	n := tc.DeleteFunc(func(k string, v int) bool {
+		return v%2 == 0
+	})
+	assert.Equal(t, 2, n)
+	assert.ElementsMatch(t, []string{"b", "d"}, evicted)
+	assert.ElementsMatch(t, []string{"a", "c"}, tc.Keys())
+
+	n = tc.DeleteFunc(func(k string, v int) bool {
+		return false
+	})
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 2, len(evicted))
+}
+
+func TestGetStale(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	tc := New[string, int](DefaultExpiration, 0, WithClock[string, int](clock))
+	tc.Set("a", 1, time.Minute)
+	tc.Set("b", 2, NoExpiration)
+
+	v, expired, found := tc.GetStale("a")
+	assert.True(t, found)
+	assert.False(t, expired)
+	assert.Equal(t, 1, v)
+
+	clock.Advance(2 * time.Minute)
+	v, expired, found = tc.GetStale("a")
+	assert.True(t, found)
+	assert.True(t, expired)
+	assert.Equal(t, 1, v)
+	_, found = tc.Get("a")
+	assert.False(t, found, "GetStale revived an expired item")
+
+	v, expired, found = tc.GetStale("b")
+	assert.True(t, found)
+	assert.False(t, expired)
+	assert.Equal(t, 2, v)
+
+	tc.DeleteExpired()
+	_, _, found = tc.GetStale("a")
+	assert.False(t, found)
+	_, _, found = tc.GetStale("missing")
+	assert.False(t, found)
+}
+
+func TestKeyedConstructors(t *testing.T) {
+	sc := NewStringKeyed[int](DefaultExpiration, 0, WithMaxItems[string, int](1))
+	sc.Set("a", 1, DefaultExpiration)
+	sc.Set("b", 2, DefaultExpiration)
+	v, found := sc.Get("b")
+	assert.True(t, found)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, 1, sc.ItemCount())
+
+	ic := NewIntKeyed[string](time.Hour, 0)
+	ic.Set(1, "a", DefaultExpiration)
+	s, found := ic.Get(1)
+	assert.True(t, found)
+	assert.Equal(t, "a", s)
+	assert.Equal(t, time.Hour, ic.DefaultExpiration())
+}
+
+func TestCountUnexpired(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, time.Hour)
+	tc.Set("c", 3, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+	assert.Equal(t, 3, tc.ItemCount())
+	assert.Equal(t, 2, tc.CountUnexpired())
+}
+
+func TestExpiredCount(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, time.Hour)
+	tc.Set("c", 3, time.Millisecond)
+	tc.Set("d", 4, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+	assert.Equal(t, 2, tc.ExpiredCount())
+	tc.DeleteExpired()
+	assert.Equal(t, 0, tc.ExpiredCount())
+}
+
+func TestCap(t *testing.T) {
+	tc := New[int, int](DefaultExpiration, 0)
+	assert.Equal(t, 0, tc.Cap())
+	for i := 0; i < 10; i++ {
+		tc.Set(i, i, DefaultExpiration)
+	}
+	for i := 0; i < 5; i++ {
+		tc.Delete(i)
+	}
+	assert.Equal(t, 5, tc.ItemCount())
+	assert.Equal(t, 10, tc.Cap())
+	tc.Set(0, 0, DefaultExpiration)
+	assert.Equal(t, 10, tc.Cap())
+	tc.Flush()
+	assert.Equal(t, 0, tc.Cap())
+
+	items := map[int]Item[int]{1: {Object: 1}, 2: {Object: 2}}
+	tc = NewFrom[int, int](DefaultExpiration, 0, items)
+	assert.Equal(t, 2, tc.Cap())
+	tc.Set(3, 3, DefaultExpiration)
+	assert.Equal(t, 3, len(items), "NewFrom copied the items map")
+}
+
+func TestKeys(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+	assert.ElementsMatch(t, []string{"a", "b"}, tc.Keys())
+}
+
+func TestOldestN(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("forever", 0, NoExpiration)
+	tc.Set("c", 3, 3*time.Hour)
+	tc.Set("a", 1, time.Hour)
+	tc.Set("b", 2, 2*time.Hour)
+	tc.Set("expired", 4, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+
+	assert.Equal(t, []string{"a", "b"}, tc.OldestN(2))
+	assert.Equal(t, []string{"a", "b", "c", "forever"}, tc.OldestN(10))
+	assert.Empty(t, tc.OldestN(0))
+}
+
+func TestGetSliding(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	tc := New[string, int](DefaultExpiration, 0, WithClock[string, int](clock))
+	tc.Set("sliding", 1, 30*time.Millisecond)
+	tc.Set("fixed", 2, 30*time.Millisecond)
+	tc.Set("forever", 3, NoExpiration)
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(15 * time.Millisecond)
+		_, found := tc.GetSliding("sliding")
+		assert.True(t, found, "sliding item expired even though it was read")
+	}
+	_, found := tc.Get("fixed")
+	assert.False(t, found, "fixed item was extended without GetSliding")
+
+	x, found := tc.GetSliding("forever")
+	assert.True(t, found)
+	assert.Equal(t, 3, x)
+	assert.Equal(t, int64(0), tc.items["forever"].Expiration)
+
+	clock.Advance(40 * time.Millisecond)
+	_, found = tc.GetSliding("sliding")
+	assert.False(t, found, "expired item was revived by GetSliding")
+}
+
+func TestTouch(t *testing.T) {
+	tc := New[string, int](50*time.Millisecond, 0)
+	tc.Set("a", 1, 20*time.Millisecond)
+	tc.Set("b", 2, 20*time.Millisecond)
+
+	assert.True(t, tc.Touch("a", NoExpiration))
+	assert.True(t, tc.Touch("b", DefaultExpiration))
+	assert.False(t, tc.Touch("missing", DefaultExpiration))
+
+	<-time.After(30 * time.Millisecond)
+	x, found := tc.Get("a")
+	assert.True(t, found, "a expired even though it was touched with NoExpiration")
+	assert.Equal(t, 1, x)
+	_, found = tc.Get("b")
+	assert.True(t, found, "b expired even though it was touched with DefaultExpiration")
+
+	<-time.After(30 * time.Millisecond)
+	assert.False(t, tc.Touch("b", NoExpiration), "expired b was touched")
+}
+
+func TestGetAndDelete(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	var evicted []string
+	tc.OnEvicted(func(k string, v int) {
+		evicted = append(evicted, k)
+	})
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Set("expired", 2, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+
+	x, found := tc.GetAndDelete("foo")
+	assert.True(t, found)
+	assert.Equal(t, 1, x)
+	_, found = tc.Get("foo")
+	assert.False(t, found, "foo was not deleted")
+
+	_, found = tc.GetAndDelete("foo")
+	assert.False(t, found, "foo was taken twice")
+	_, found = tc.GetAndDelete("expired")
+	assert.False(t, found, "expired item was returned")
+	assert.Equal(t, []string{"foo"}, evicted)
+}
+
+func TestSetReturningOld(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	evicted := 0
+	tc.OnEvicted(func(string, int) {
+		evicted++
+	})
+	old, existed := tc.SetReturningOld("a", 1, DefaultExpiration)
+	assert.False(t, existed)
+	assert.Equal(t, 0, old)
+
+	old, existed = tc.SetReturningOld("a", 2, time.Millisecond)
+	assert.True(t, existed)
+	assert.Equal(t, 1, old)
+	<-time.After(2 * time.Millisecond)
+
+	old, existed = tc.SetReturningOld("a", 3, DefaultExpiration)
+	assert.True(t, existed)
+	assert.Equal(t, 2, old)
+	v, found := tc.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, 3, v)
+	assert.Equal(t, 0, evicted)
+}
+
+func TestExportSorted(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	tc := New[string, int](DefaultExpiration, 0, WithClock[string, int](clock))
+	tc.Set("c", 3, NoExpiration)
+	tc.Set("a", 1, time.Minute)
+	tc.Set("b", 2, time.Hour)
+	tc.Set("expired", 4, time.Second)
+	clock.Advance(2 * time.Second)
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := tc.ExportSorted(func(a, b string) bool { return a < b })
+	assert.Equal(t, []ItemEntry[string, int]{
+		{"a", 1, time.Unix(0, start.Add(time.Minute).UnixNano())},
+		{"b", 2, time.Unix(0, start.Add(time.Hour).UnixNano())},
+		{"c", 3, time.Time{}},
+	}, entries)
+}
+
+func TestShiftExpirations(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	tc := New[string, int](DefaultExpiration, 0, WithClock[string, int](clock))
+	tc.Set("never", 0, NoExpiration)
+	tc.Set("a", 1, time.Minute)
+	tc.Set("expired", 2, time.Second)
+	clock.Advance(2 * time.Second)
+
+	tc.ShiftExpirations(time.Hour)
+	_, exp, found := tc.GetWithExpiration("a")
+	assert.True(t, found)
+	assert.True(t, exp.Equal(start.Add(time.Hour+time.Minute)))
+	_, exp, found = tc.GetWithExpiration("never")
+	assert.True(t, found)
+	assert.True(t, exp.IsZero(), "an item that never expires was shifted")
+	assert.False(t, tc.Contains("expired"))
+
+	tc.ShiftExpirations(-30 * time.Minute)
+	_, exp, _ = tc.GetWithExpiration("a")
+	assert.True(t, exp.Equal(start.Add(30*time.Minute+time.Minute)))
+
+	tc.ShiftExpirations(-time.Hour)
+	assert.False(t, tc.Contains("a"))
+	assert.True(t, tc.Contains("never"))
+}
+
+func TestCompact(t *testing.T) {
+	tc := New[int, int](DefaultExpiration, 0)
+	expired := 0
+	tc.OnExpired(func(int, int) {
+		expired++
+	})
+	for i := 0; i < 100; i++ {
+		tc.Set(i, i, DefaultExpiration)
+	}
+	for i := 0; i < 90; i++ {
+		tc.Delete(i)
+	}
+	tc.Set(100, 100, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+
+	before, after := tc.Compact()
+	assert.Equal(t, 100, before)
+	assert.Equal(t, 10, after)
+	assert.Equal(t, 10, tc.Cap())
+	assert.Equal(t, 1, expired)
+	for i := 90; i < 100; i++ {
+		v, found := tc.Get(i)
+		assert.True(t, found)
+		assert.Equal(t, i, v)
+	}
+}
+
+func TestWithValidator(t *testing.T) {
+	errNegative := errors.New("negative")
+	tc := New[string, int](DefaultExpiration, 0, WithValidator(func(k string, v int) error {
+		if v < 0 {
+			return errNegative
+		}
+		return nil
+	}))
+	assert.ErrorIs(t, tc.SetValidated("a", -1, DefaultExpiration), errNegative)
+	assert.False(t, tc.Contains("a"))
+	assert.NoError(t, tc.SetValidated("a", 1, DefaultExpiration))
+
+	assert.ErrorIs(t, tc.Add("b", -1, DefaultExpiration), errNegative)
+	assert.False(t, tc.Contains("b"))
+	assert.NoError(t, tc.Add("b", 2, DefaultExpiration))
+
+	assert.ErrorIs(t, tc.Replace("a", -1, DefaultExpiration), errNegative)
+	_, _, err := tc.AddOrGet("c", -1, DefaultExpiration)
+	assert.ErrorIs(t, err, errNegative)
+	assert.False(t, tc.Contains("c"))
+	v, _ := tc.Get("a")
+	assert.Equal(t, 1, v)
+
+	// Set can't report the error, so it doesn't validate
+	tc.Set("d", -1, DefaultExpiration)
+	assert.True(t, tc.Contains("d"))
+}
+
+func TestRename(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	tc := New[string, int](DefaultExpiration, 0, WithClock[string, int](clock))
+	var evicted []string
+	tc.OnEvicted(func(k string, v int) {
+		evicted = append(evicted, k+"="+strconv.Itoa(v))
+	})
+	tc.Set("a", 1, time.Minute)
+	tc.Set("b", 2, DefaultExpiration)
+
+	assert.True(t, tc.Rename("a", "c"))
+	assert.False(t, tc.Contains("a"))
+	v, exp, found := tc.GetWithExpiration("c")
+	assert.True(t, found)
+	assert.Equal(t, 1, v)
+	assert.True(t, exp.Equal(clock.Now().Add(time.Minute)))
+	assert.Empty(t, evicted)
+
+	assert.True(t, tc.Rename("c", "b"))
+	v, found = tc.Get("b")
+	assert.True(t, found)
+	assert.Equal(t, 1, v)
+	assert.Equal(t, []string{"b=2"}, evicted)
+
+	assert.False(t, tc.Rename("missing", "d"))
+	clock.Advance(2 * time.Minute)
+	assert.False(t, tc.Rename("b", "d"))
+	assert.False(t, tc.Contains("d"))
+	assert.Equal(t, 1, tc.ItemCount())
+}
+
+func TestGetAndDeleteConcurrent(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("foo", 1, DefaultExpiration)
+	var taken int32
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, found := tc.GetAndDelete("foo"); found {
+				atomic.AddInt32(&taken, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), taken)
+}
+
+func TestRange(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+
+	seen := map[string]int{}
+	tc.Range(func(k string, v int) bool {
+		seen[k] = v
+		return true
+	})
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, seen)
+
+	n := 0
+	tc.Range(func(k string, v int) bool {
+		n++
+		return false
+	})
+	assert.Equal(t, 1, n, "Range didn't stop when fn returned false")
+}
+
+func TestOnExpired(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	var evicted, expired []string
+	tc.OnEvicted(func(k string, v int) {
+		evicted = append(evicted, k)
+	})
+	tc.OnExpired(func(k string, v int) {
+		expired = append(expired, k)
+	})
+	tc.Set("deleted", 1, time.Millisecond)
+	tc.Set("expired", 2, time.Millisecond)
+	tc.Delete("deleted")
+	<-time.After(2 * time.Millisecond)
+	tc.DeleteExpired()
+
+	assert.Equal(t, []string{"deleted"}, evicted)
+	assert.Equal(t, []string{"expired"}, expired)
+
+	// Without an OnExpired function expired items go to OnEvicted
+	tc.OnExpired(nil)
+	tc.Set("expired", 2, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+	tc.DeleteExpired()
+	assert.Equal(t, []string{"deleted", "expired"}, evicted)
+}
+
+func TestWithExpirationChannel(t *testing.T) {
+	clock := NewFakeClock(time.Date(2022, 6, 16, 0, 0, 0, 0, time.UTC))
+	tc := New[string, int](DefaultExpiration, 0,
+		WithClock[string, int](clock),
+		WithExpirationChannel[string, int](1))
+	ch := tc.ExpirationChannel()
+	tc.Set("a", 1, time.Second)
+	tc.Set("b", 2, time.Minute)
+	clock.Advance(2 * time.Second)
+	tc.DeleteExpired()
+	assert.Equal(t, KeyValue[string, int]{"a", 1}, <-ch)
+
+	tc.Set("c", 3, time.Second)
+	clock.Advance(2 * time.Minute)
+	tc.DeleteExpired()
+	assert.Equal(t, uint64(1), tc.Stats().DroppedExpirations)
+	<-ch
+
+	tc.Close()
+	_, ok := <-ch
+	assert.False(t, ok, "channel not closed")
+	tc.Set("d", 4, time.Second)
+	clock.Advance(2 * time.Second)
+	tc.DeleteExpired()
+	assert.Nil(t, New[string, int](DefaultExpiration, 0).ExpirationChannel())
+}
+
+func TestWithExpiryInspector(t *testing.T) {
+	clock := NewFakeClock(time.Date(2022, 6, 16, 0, 0, 0, 0, time.UTC))
+	var tc *Cache[string, int]
+	var inspected []string
+	tc = New[string, int](DefaultExpiration, 0,
+		WithClock[string, int](clock),
+		WithExpiryInspector[string, int](func(k string, v int) bool {
+			inspected = append(inspected, k)
+			switch k {
+			case "keep":
+				return false
+			case "replaced":
+				// The inspector runs without the lock held
+				tc.Set(k, v, time.Hour)
+			}
+			return true
+		}))
+	tc.Set("keep", 1, time.Second)
+	tc.Set("delete", 2, time.Second)
+	tc.Set("replaced", 3, time.Second)
+	tc.Set("fresh", 4, time.Hour)
+	clock.Advance(2 * time.Second)
+	tc.DeleteExpired()
+
+	assert.ElementsMatch(t, []string{"keep", "delete", "replaced"}, inspected)
+	assert.Equal(t, 3, tc.ItemCount())
+	_, found := tc.Get("keep")
+	assert.False(t, found, "a kept expired item was returned")
+	_, found = tc.Get("replaced")
+	assert.True(t, found, "an item stored during the sweep was deleted")
+
+	inspected = nil
+	tc.DeleteExpired()
+	assert.Equal(t, []string{"keep"}, inspected)
+}
+
+func TestWithExpirationBatchSize(t *testing.T) {
+	clock := NewFakeClock(time.Date(2022, 6, 16, 0, 0, 0, 0, time.UTC))
+	tc := New[int, int](DefaultExpiration, 0,
+		WithClock[int, int](clock),
+		WithExpirationBatchSize[int, int](3))
+	var expired []int
+	tc.OnExpired(func(k int, v int) {
+		expired = append(expired, k)
+	})
+	for i := 0; i < 10; i++ {
+		tc.Set(i, i, time.Second)
+	}
+	tc.Set(10, 10, time.Minute)
+	tc.SetNegative(11, time.Second)
+	clock.Advance(2 * time.Second)
+	tc.DeleteExpired()
+
+	assert.Len(t, expired, 10)
+	assert.Equal(t, 1, tc.ItemCount())
+	assert.Equal(t, uint64(10), tc.Stats().Expirations)
+	assert.Empty(t, tc.negatives)
+}
+
+func TestSetManyWithExpiration(t *testing.T) {
+	clock := NewFakeClock(time.Date(2022, 6, 16, 0, 0, 0, 0, time.UTC))
+	tc := New[string, int](time.Minute, 0, WithClock[string, int](clock))
+	var replaced []string
+	tc.OnEvicted(func(k string, v int) {
+		replaced = append(replaced, k)
+	})
+	tc.Set("a", 0, DefaultExpiration)
+	tc.SetManyWithExpiration(map[string]ExpiringValue[int]{
+		"a":       {1, time.Second},
+		"b":       {2, DefaultExpiration},
+		"forever": {3, NoExpiration},
+	})
+	assert.Equal(t, []string{"a"}, replaced)
+	ttl, _ := tc.TTL("a")
+	assert.Equal(t, time.Second, ttl)
+	ttl, _ = tc.TTL("b")
+	assert.Equal(t, time.Minute, ttl)
+	ttl, _ = tc.TTL("forever")
+	assert.Equal(t, NoExpiration, ttl)
+}
+
+func TestSetMany(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	var evicted []string
+	tc.OnEvicted(func(k string, v int) {
+		evicted = append(evicted, k)
+	})
+	tc.Set("a", 0, DefaultExpiration)
+	tc.SetMany(map[string]int{"a": 1, "b": 2, "c": 3}, 20*time.Millisecond)
+	assert.Equal(t, []string{"a"}, evicted)
+	assert.Equal(t, 3, tc.ItemCount())
+	x, found := tc.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, 1, x)
+
+	<-time.After(25 * time.Millisecond)
+	_, found = tc.Get("b")
+	assert.False(t, found, "b didn't expire")
+}
+
+func TestGetMany(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+	m := tc.GetMany([]string{"a", "b", "c", "d"})
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, m)
+	assert.Equal(t, uint64(2), tc.Stats().Hits)
+	assert.Equal(t, uint64(2), tc.Stats().Misses)
+}
+
+func TestGetManyWithExpiration(t *testing.T) {
+	start := time.Date(2022, 6, 16, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	tc := New[string, int](DefaultExpiration, 0, WithClock[string, int](clock))
+	tc.Set("a", 1, NoExpiration)
+	tc.Set("b", 2, time.Minute)
+	tc.Set("c", 3, time.Millisecond)
+	clock.Advance(time.Second)
+	m := tc.GetManyWithExpiration([]string{"a", "b", "c", "d"})
+	assert.Len(t, m, 2)
+	assert.Equal(t, ItemView[int]{Value: 1}, m["a"])
+	assert.Equal(t, 2, m["b"].Value)
+	assert.True(t, m["b"].Expiration.Equal(start.Add(time.Minute)))
+	assert.Equal(t, uint64(2), tc.Stats().Hits)
+	assert.Equal(t, uint64(2), tc.Stats().Misses)
+}
+
+func TestUpdate(t *testing.T) {
+	tc := New[string, []int](DefaultExpiration, 0)
+	appendFn := func(n int) func([]int, bool) ([]int, bool) {
+		return func(old []int, found bool) ([]int, bool) {
+			return append(old, n), true
+		}
+	}
+	x, stored := tc.Update("foo", appendFn(1))
+	assert.True(t, stored)
+	assert.Equal(t, []int{1}, x)
+	tc.Update("foo", appendFn(2))
+	x, found := tc.Get("foo")
+	assert.True(t, found)
+	assert.Equal(t, []int{1, 2}, x)
+
+	_, stored = tc.Update("foo", func(old []int, found bool) ([]int, bool) {
+		assert.True(t, found)
+		return nil, false
+	})
+	assert.False(t, stored)
+	x, _ = tc.Get("foo")
+	assert.Equal(t, []int{1, 2}, x, "foo was changed even though fn returned false")
+
+	_, stored = tc.Update("bar", func(old []int, found bool) ([]int, bool) {
+		assert.False(t, found)
+		assert.Nil(t, old)
+		return nil, false
+	})
+	assert.False(t, stored)
+	_, found = tc.Get("bar")
+	assert.False(t, found, "bar was created even though fn returned false")
+}
+
+func TestUpdateKeepsExpiration(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("foo", 1, time.Hour)
+	_, exp, _ := tc.GetWithExpiration("foo")
+	tc.Update("foo", func(old int, found bool) (int, bool) {
+		return old + 1, true
+	})
+	x, exp2, found := tc.GetWithExpiration("foo")
+	assert.True(t, found)
+	assert.Equal(t, 2, x)
+	assert.True(t, exp.Equal(exp2), "Update changed the expiration time")
+}
+
+func TestFlushWithEvict(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	var evicted, expired []string
+	tc.OnEvicted(func(k string, v int) {
+		evicted = append(evicted, k)
+		// Callbacks run after the lock has been released
+		tc.Get(k)
+	})
+	tc.OnExpired(func(k string, v int) {
+		expired = append(expired, k)
+	})
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+	tc.FlushWithEvict()
+
+	assert.ElementsMatch(t, []string{"a", "b"}, evicted)
+	assert.Equal(t, []string{"c"}, expired)
+	assert.Equal(t, 0, tc.ItemCount())
+}
+
+func TestSwapItems(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	var evicted []string
+	tc.OnEvicted(func(k string, v int) {
+		evicted = append(evicted, k)
+	})
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	old := tc.SwapItems(map[string]Item[int]{"b": {Object: 3}, "c": {Object: 4}}, false)
+	assert.Len(t, old, 2)
+	assert.Equal(t, 1, old["a"].Object)
+	assert.Empty(t, evicted)
+	x, found := tc.Get("b")
+	assert.True(t, found)
+	assert.Equal(t, 3, x)
+	_, found = tc.Get("a")
+	assert.False(t, found)
+
+	tc.SwapItems(map[string]Item[int]{"c": {Object: 5}}, true)
+	assert.Equal(t, []string{"b"}, evicted)
+	assert.Equal(t, map[string]int{"c": 5}, tc.GetMany([]string{"a", "b", "c"}))
+}
+
+func TestSwapItemsMaxItems(t *testing.T) {
+	tc := New[int, int](DefaultExpiration, 0, WithMaxItems[int, int](2))
+	items := map[int]Item[int]{}
+	for i := 0; i < 5; i++ {
+		items[i] = Item[int]{Object: i}
+	}
+	tc.SwapItems(items, false)
+	assert.Equal(t, 2, tc.ItemCount())
+	tc.Set(10, 10, DefaultExpiration)
+	assert.Equal(t, 2, tc.ItemCount())
+}
+
+func TestSetCleanupInterval(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("a", 1, time.Millisecond)
+	before := runtime.NumGoroutine()
+
+	tc.SetCleanupInterval(time.Millisecond)
+	<-time.After(20 * time.Millisecond)
+	assert.Equal(t, 0, tc.ItemCount(), "janitor started by SetCleanupInterval didn't run")
+
+	tc.SetCleanupInterval(time.Hour)
+	tc.SetCleanupInterval(0)
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		<-time.After(time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before, "janitor goroutine leaked")
+
+	tc.Set("b", 1, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	assert.Equal(t, 1, tc.ItemCount(), "janitor still runs after being disabled")
+
+	tc.SetCleanupInterval(time.Millisecond)
+	tc.Close()
+	tc.SetCleanupInterval(time.Millisecond)
+	tc.mu.RLock()
+	assert.Nil(t, tc.janitor, "janitor was started on a closed cache")
+	tc.mu.RUnlock()
+}
+
+func TestSetCleanupIntervalWithWorkers(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "snapshot")
+	opts := map[string]Option[string, int]{
+		"WithWriteBehind": WithWriteBehind[string, int](func(map[string]int, []string) error {
+			return nil
+		}, time.Hour),
+		"WithPeriodicSnapshot":     WithPeriodicSnapshot[string, int](fname, time.Hour, nil),
+		"WithCoarseClock":          WithCoarseClock[string, int](10 * time.Millisecond),
+		"WithHeapPressureEviction": WithHeapPressureEviction[string, int](1<<40, time.Hour),
+	}
+	for name, opt := range opts {
+		t.Run(name, func(t *testing.T) {
+			tc := New[string, int](DefaultExpiration, 0, opt)
+			// Setting the finalizer again would be a fatal error
+			tc.SetCleanupInterval(time.Second)
+			tc.SetCleanupInterval(0)
+			tc.SetCleanupInterval(time.Second)
+			tc.Close()
+		})
+	}
+}
+
+func TestWithoutJanitor(t *testing.T) {
+	before := runtime.NumGoroutine()
+	caches := make([]*Cache[string, int], 100)
+	for i := range caches {
+		caches[i] = New[string, int](DefaultExpiration, time.Millisecond, WithoutJanitor[string, int]())
+		caches[i].SetCleanupInterval(time.Millisecond)
+	}
+	sc := NewSharded[string, int](DefaultExpiration, time.Millisecond, 4, nil, WithoutJanitor[string, int]())
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before, "a janitor goroutine was started")
+	for _, tc := range caches {
+		assert.Nil(t, tc.janitor)
+	}
+	assert.Nil(t, sc.janitor)
+
+	// Expired items are still never returned.
+	tc := caches[0]
+	tc.Set("a", 1, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	_, found := tc.Get("a")
+	assert.False(t, found)
+	assert.Equal(t, 1, tc.ItemCount())
+	tc.DeleteExpired()
+	assert.Equal(t, 0, tc.ItemCount())
+}
+
+func TestRenewOrSet(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	tc := New[string, int](DefaultExpiration, 0, WithClock[string, int](clock))
+	assert.False(t, tc.RenewOrSet("heartbeat", 1, 20*time.Millisecond), "missing item was renewed")
+	clock.Advance(15 * time.Millisecond)
+	assert.True(t, tc.RenewOrSet("heartbeat", 2, 20*time.Millisecond))
+	clock.Advance(15 * time.Millisecond)
+	x, found := tc.Get("heartbeat")
+	assert.True(t, found, "renewed item expired")
+	assert.Equal(t, 1, x, "RenewOrSet changed the value of a renewed item")
+
+	clock.Advance(10 * time.Millisecond)
+	assert.False(t, tc.RenewOrSet("heartbeat", 3, DefaultExpiration), "expired item was renewed")
+	x, _ = tc.Get("heartbeat")
+	assert.Equal(t, 3, x)
+}
+
+func TestItemsIncludingExpired(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+
+	assert.Len(t, tc.Items(), 1)
+	items := tc.ItemsIncludingExpired()
+	assert.Len(t, items, 2)
+	assert.False(t, items["a"].Expired())
+	assert.True(t, items["b"].Expired())
+}
+
+func TestMutateInPlace(t *testing.T) {
+	type session struct {
+		Pages []string
+		Seen  map[string]int
+	}
+	tc := New[string, session](DefaultExpiration, 0)
+	assert.False(t, tc.MutateInPlace("missing", func(s *session) {
+		t.Error("fn was called for a missing key")
+	}))
+	tc.Set("a", session{Seen: map[string]int{}}, DefaultExpiration)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.True(t, tc.MutateInPlace("a", func(s *session) {
+				s.Pages = append(s.Pages, "/")
+				s.Seen["/"]++
+			}))
+		}()
+		go func() {
+			defer wg.Done()
+			tc.MutateInPlace("a", func(s *session) {
+				assert.Equal(t, len(s.Pages), s.Seen["/"], "observed a partial mutation")
+			})
+		}()
+	}
+	wg.Wait()
+	x, _ := tc.Get("a")
+	assert.Len(t, x.Pages, 10)
+	assert.Equal(t, 10, x.Seen["/"])
+}
+
+func TestMutateInPlaceAccounting(t *testing.T) {
+	size := func(k string, m map[string]int) int64 { return int64(len(m)) }
+	hash := func(m map[string]int) uint64 { return uint64(len(m)) }
+	tc := New[string, map[string]int](DefaultExpiration, 0,
+		WithMaxBytes[string, map[string]int](100, size),
+		WithValueHasher[string, map[string]int](hash))
+	tc.Set("a", map[string]int{"x": 1}, DefaultExpiration)
+	tc.Set("b", map[string]int{"x": 1}, DefaultExpiration)
+	assert.Equal(t, int64(2), tc.size)
+	assert.Equal(t, 1, tc.Stats().UniqueValues)
+
+	tc.MutateInPlace("a", func(m *map[string]int) {
+		(*m)["y"] = 2
+		(*m)["z"] = 3
+	})
+	assert.Equal(t, int64(4), tc.size)
+	assert.Equal(t, 2, tc.Stats().UniqueValues)
+
+	tc.Delete("a")
+	tc.Delete("b")
+	assert.Equal(t, int64(0), tc.size)
+	assert.Equal(t, 0, tc.Stats().UniqueValues)
+}
+
+func TestPopN(t *testing.T) {
+	tc := New[int, int](DefaultExpiration, 0)
+	var evicted []int
+	tc.OnEvicted(func(k int, v int) {
+		evicted = append(evicted, k)
+	})
+	for i := 0; i < 5; i++ {
+		tc.Set(i, i*10, DefaultExpiration)
+	}
+	tc.Set(5, 50, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+
+	popped := tc.PopN(3)
+	assert.Len(t, popped, 3)
+	for k, v := range popped {
+		assert.Equal(t, k*10, v)
+		assert.False(t, tc.Contains(k))
+	}
+	assert.Len(t, evicted, 3)
+
+	popped = tc.PopN(10)
+	assert.Len(t, popped, 2, "popped an expired item")
+	assert.NotContains(t, popped, 5)
+	assert.Equal(t, 1, tc.ItemCount())
+	assert.Empty(t, tc.PopN(10))
+	assert.Equal(t, uint64(5), tc.Stats().Evictions)
+}
+
+func TestGroupBy(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	for i := 1; i <= 6; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	tc.Set("expired", 7, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+	groups := tc.GroupBy(func(k string, v int) string {
+		if v%2 == 0 {
+			return "even"
+		}
+		return "odd"
+	})
+	assert.Len(t, groups, 2)
+	assert.ElementsMatch(t, []int{2, 4, 6}, groups["even"])
+	assert.ElementsMatch(t, []int{1, 3, 5}, groups["odd"])
+}
+
+func TestExpirationHistogram(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	tc := New[string, int](DefaultExpiration, 0, WithClock[string, int](clock))
+	tc.Set("never", 0, NoExpiration)
+	tc.Set("a", 1, 30*time.Second)
+	tc.Set("b", 2, time.Minute)
+	tc.Set("c", 3, 5*time.Minute)
+	tc.Set("d", 4, time.Hour)
+	tc.Set("expired", 5, time.Second)
+	clock.Advance(2 * time.Second)
+	hist := tc.ExpirationHistogram([]time.Duration{10 * time.Minute, time.Minute, 10 * time.Second})
+	assert.Equal(t, map[time.Duration]int{
+		NoExpiration:                 1,
+		10 * time.Second:             0,
+		time.Minute:                  2,
+		10 * time.Minute:             1,
+		time.Duration(math.MaxInt64): 1,
+	}, hist)
+}
+
+func TestContains(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("expired", 2, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+	assert.True(t, tc.Contains("a"))
+	assert.False(t, tc.Contains("expired"))
+	assert.False(t, tc.Contains("missing"))
+	assert.Equal(t, Stats{ItemCount: 2}, tc.Stats())
+}
+
+func TestGetItem(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("a", 1, time.Hour)
+	tc.Set("expired", 2, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+
+	item, found := tc.GetItem("a")
+	assert.True(t, found)
+	assert.Equal(t, 1, item.Object)
+	assert.Greater(t, item.RemainingTTL(), 59*time.Minute)
+	_, exp, _ := tc.GetWithExpiration("a")
+	assert.True(t, item.ExpiresAt().Equal(exp))
+
+	item, found = tc.GetItem("expired")
+	assert.False(t, found)
+	assert.Equal(t, Item[int]{}, item)
+	assert.Equal(t, uint64(1), tc.Stats().Hits)
+	assert.Equal(t, uint64(1), tc.Stats().Misses)
+}
+
+func TestItemsExported(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	want := map[string]Item[int]{"a": {Object: 1}, "b": {Object: 2}}
+	assert.Equal(t, want, tc.Items())
+	assert.Equal(t, want, tc.ItemsIncludingExpired())
+	item, _ := tc.GetItem("a")
+	assert.Equal(t, Item[int]{Object: 1}, item)
+
+	var seen []Item[int]
+	tc.load(map[string]Item[int]{"a": {Object: 3}}, func(existing, incoming Item[int]) Item[int] {
+		seen = append(seen, existing, incoming)
+		return incoming
+	})
+	assert.Equal(t, []Item[int]{{Object: 1}, {Object: 3}}, seen)
+
+	old := tc.SwapItems(map[string]Item[int]{"c": {Object: 4}}, false)
+	assert.Equal(t, map[string]Item[int]{"a": {Object: 3}, "b": {Object: 2}}, old)
+}
+
+func TestItemRemainingTTL(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("a", 1, NoExpiration)
+	tc.Set("b", 2, time.Hour)
+	tc.Set("c", 3, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+
+	items := tc.ItemsIncludingExpired()
+	assert.True(t, items["a"].ExpiresAt().IsZero())
+	assert.Equal(t, NoExpiration, items["a"].RemainingTTL())
+	assert.Equal(t, items["b"].Expiration, items["b"].ExpiresAt().UnixNano())
+	assert.Greater(t, items["b"].RemainingTTL(), 59*time.Minute)
+	assert.LessOrEqual(t, items["b"].RemainingTTL(), time.Hour)
+	assert.Equal(t, time.Duration(0), items["c"].RemainingTTL())
+}
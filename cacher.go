@@ -0,0 +1,33 @@
+package cache
+
+import "time"
+
+// Cacher is the interface of the main methods of a cache, implemented by both
+// Cache and ShardedCache. Code that only needs these methods can accept a
+// Cacher instead of a concrete cache type, so that tests can pass a fake.
+type Cacher[K comparable, T any] interface {
+	// Set adds an item to the cache, replacing any existing item. See
+	// Cache.Set.
+	Set(k K, x T, d time.Duration)
+	// Add adds an item to the cache only if no unexpired item exists for
+	// the key. See Cache.Add.
+	Add(k K, x T, d time.Duration) error
+	// Replace sets a new value for the key only if an unexpired item
+	// exists for it. See Cache.Replace.
+	Replace(k K, x T, d time.Duration) error
+	// Get gets an item from the cache. See Cache.Get.
+	Get(k K) (T, bool)
+	// GetWithExpiration gets an item and its expiration time from the
+	// cache. See Cache.GetWithExpiration.
+	GetWithExpiration(k K) (T, time.Time, bool)
+	// Delete deletes an item from the cache. See Cache.Delete.
+	Delete(k K)
+	// Items copies all unexpired items in the cache into a new map. See
+	// Cache.Items.
+	Items() map[K]Item[T]
+	// ItemCount returns the number of items in the cache. See
+	// Cache.ItemCount.
+	ItemCount() int
+	// Flush deletes all items from the cache. See Cache.Flush.
+	Flush()
+}
@@ -0,0 +1,31 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacher(t *testing.T) {
+	for name, c := range map[string]Cacher[string, int]{
+		"Cache":        New[string, int](DefaultExpiration, 0),
+		"ShardedCache": NewSharded[string, int](DefaultExpiration, 0, 4, nil),
+	} {
+		c.Set("a", 1, DefaultExpiration)
+		assert.NoError(t, c.Add("b", 2, time.Hour), name)
+		assert.Error(t, c.Add("b", 3, DefaultExpiration), name)
+		assert.NoError(t, c.Replace("a", 4, DefaultExpiration), name)
+		v, found := c.Get("a")
+		assert.True(t, found, name)
+		assert.Equal(t, 4, v, name)
+		_, exp, found := c.GetWithExpiration("b")
+		assert.True(t, found, name)
+		assert.False(t, exp.IsZero(), name)
+		assert.Len(t, c.Items(), 2, name)
+		c.Delete("a")
+		assert.Equal(t, 1, c.ItemCount(), name)
+		c.Flush()
+		assert.Equal(t, 0, c.ItemCount(), name)
+	}
+}
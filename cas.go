@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// CompareAndSwap replaces the item for the given key with new, using the
+// expiration duration d (see Set), but only if the key holds an unexpired
+// item whose value is equal to old according to eq. Returns whether the item
+// was swapped.
+func (c *cache[K, T]) CompareAndSwap(k K, old, new T, d time.Duration, eq func(T, T) bool) bool {
+	c.mu.Lock()
+	v, found := c.get(k)
+	if !found || !eq(v, old) {
+		c.mu.Unlock()
+		return false
+	}
+	c.set(k, new, d)
+	var evicted []keyAndValue[K, T]
+	if c.policy != nil {
+		evicted = c.evictOverflow()
+	}
+	hooks := c.hooks()
+	c.mu.Unlock()
+	hooks.fireAll(evicted)
+	return true
+}
+
+// CompareAndDelete deletes the item for the given key, but only if the key
+// holds an unexpired item whose value is equal to old according to eq.
+// Returns whether the item was deleted. As with Delete, the OnEvicted
+// function is called for the deleted item.
+func (c *cache[K, T]) CompareAndDelete(k K, old T, eq func(T, T) bool) bool {
+	c.mu.Lock()
+	v, found := c.get(k)
+	if !found || !eq(v, old) {
+		c.mu.Unlock()
+		return false
+	}
+	_, cleanup, _ := c.delete(k)
+	c.forgetDirty(k)
+	hooks := c.hooks()
+	c.mu.Unlock()
+	atomic.AddUint64(&c.stats.evictions, 1)
+	hooks.fire(k, v, Deleted, cleanup)
+	return true
+}
+
+// GetVersioned gets an item from the cache like Peek, together with its
+// version. Every item that is stored, by Set or any other method that changes
+// an item's value, gets a new version that is greater than that of any item
+// stored in the cache before it, so a version identifies a value stored under
+// a key even if the values aren't comparable. Methods that only change an
+// item's expiration, such as Touch, keep its version. The version of a
+// missing item is 0.
+func (c *cache[K, T]) GetVersioned(k K) (T, uint64, bool) {
+	if c.policy != nil {
+		c.mu.Lock()
+	} else {
+		c.mu.RLock()
+	}
+	item, found := c.items[k]
+	found = found && !c.expired(item)
+	if found && c.policy != nil {
+		c.policy.RecordAccess(k)
+	}
+	if c.policy != nil {
+		c.mu.Unlock()
+	} else {
+		c.mu.RUnlock()
+	}
+	if !found {
+		c.miss(k)
+		return *new(T), 0, false
+	}
+	c.hit(k)
+	return item.Object, item.version, true
+}
+
+// SetIfVersion stores x under the given key with the expiration duration d
+// (see Set), but only if the key holds an unexpired item whose version (see
+// GetVersioned) is version, or, if version is 0, only if it holds no unexpired
+// item. Returns whether x was stored. Together with GetVersioned it allows a
+// compare-and-swap that, unlike CompareAndSwap, doesn't compare values.
+func (c *cache[K, T]) SetIfVersion(k K, x T, d time.Duration, version uint64) bool {
+	c.mu.Lock()
+	var current uint64
+	if item, found := c.items[k]; found && !c.expired(item) {
+		current = item.version
+	}
+	if current != version {
+		c.mu.Unlock()
+		return false
+	}
+	c.set(k, x, d)
+	var evicted []keyAndValue[K, T]
+	if c.policy != nil {
+		evicted = c.evictOverflow()
+	}
+	hooks := c.hooks()
+	c.mu.Unlock()
+	hooks.fireAll(evicted)
+	return true
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func equalInts(a, b int) bool {
+	return a == b
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	assert.False(t, tc.CompareAndSwap("foo", 0, 1, DefaultExpiration, equalInts), "swapped a missing key")
+	tc.Set("foo", 1, DefaultExpiration)
+	assert.False(t, tc.CompareAndSwap("foo", 2, 3, DefaultExpiration, equalInts), "swapped a different value")
+	assert.True(t, tc.CompareAndSwap("foo", 1, 3, time.Millisecond, equalInts))
+	x, found := tc.Get("foo")
+	assert.True(t, found)
+	assert.Equal(t, 3, x)
+
+	<-time.After(2 * time.Millisecond)
+	assert.False(t, tc.CompareAndSwap("foo", 3, 4, DefaultExpiration, equalInts), "swapped an expired item")
+}
+
+func TestCompareAndDelete(t *testing.T) {
+	tc := New[string, []int](DefaultExpiration, 0)
+	var evicted []string
+	tc.OnEvicted(func(k string, v []int) {
+		evicted = append(evicted, k)
+	})
+	eq := func(a, b []int) bool {
+		return len(a) == len(b)
+	}
+	tc.Set("foo", []int{1, 2}, DefaultExpiration)
+	assert.False(t, tc.CompareAndDelete("foo", []int{1}, eq))
+	assert.True(t, tc.CompareAndDelete("foo", []int{3, 4}, eq))
+	_, found := tc.Get("foo")
+	assert.False(t, found, "foo wasn't deleted")
+	assert.Equal(t, []string{"foo"}, evicted)
+	assert.False(t, tc.CompareAndDelete("foo", []int{3, 4}, eq))
+}
+
+func TestSetIfVersion(t *testing.T) {
+	tc := New[string, []int](DefaultExpiration, 0)
+	_, version, found := tc.GetVersioned("foo")
+	assert.False(t, found)
+	assert.Equal(t, uint64(0), version)
+	assert.True(t, tc.SetIfVersion("foo", []int{1}, DefaultExpiration, 0))
+	assert.False(t, tc.SetIfVersion("foo", []int{2}, DefaultExpiration, 0), "stored over an existing item")
+
+	x, version, found := tc.GetVersioned("foo")
+	assert.True(t, found)
+	assert.Equal(t, []int{1}, x)
+	assert.True(t, tc.Touch("foo", time.Hour))
+	_, touched, _ := tc.GetVersioned("foo")
+	assert.Equal(t, version, touched, "Touch changed the version")
+
+	assert.True(t, tc.SetIfVersion("foo", []int{1, 2}, DefaultExpiration, version))
+	assert.False(t, tc.SetIfVersion("foo", []int{1, 3}, DefaultExpiration, version), "stored with a stale version")
+	x, newVersion, _ := tc.GetVersioned("foo")
+	assert.Equal(t, []int{1, 2}, x)
+	assert.Greater(t, newVersion, version)
+
+	// A deleted and stored again item gets a new version.
+	tc.Delete("foo")
+	tc.Set("foo", []int{1, 2}, DefaultExpiration)
+	_, readded, _ := tc.GetVersioned("foo")
+	assert.Greater(t, readded, newVersion)
+}
+
+func TestGetVersionedRecordsAccess(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0, WithMaxItems[string, int](2))
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	_, _, found := tc.GetVersioned("a")
+	assert.True(t, found)
+	tc.Set("c", 3, DefaultExpiration)
+	assert.ElementsMatch(t, []string{"a", "c"}, tc.Keys(), "item read by GetVersioned was evicted")
+}
+
+func TestGetVersionedNewFrom(t *testing.T) {
+	tc := NewFrom[string, int](DefaultExpiration, 0, map[string]Item[int]{"a": {Object: 1}, "b": {Object: 2}})
+	_, a, _ := tc.GetVersioned("a")
+	_, b, _ := tc.GetVersioned("b")
+	assert.NotZero(t, a)
+	assert.NotZero(t, b)
+	assert.NotEqual(t, a, b)
+	assert.True(t, tc.SetIfVersion("a", 3, DefaultExpiration, a))
+}
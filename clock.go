@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Clock tells a cache the current time. All expiration times are computed and
+// checked against the cache's clock, which by default is the system clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the default Clock, backed by time.Now.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock is a Clock whose time only changes when it is set or advanced.
+// It is meant for tests that verify expiration behavior without sleeping.
+// Note that the janitor still runs on the system clock: with a FakeClock it
+// removes whatever has expired according to the FakeClock each time it wakes
+// up. It is safe for concurrent use.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns a FakeClock whose current time is now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the clock's current time.
+func (f *FakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Advance moves the clock's current time forward by d.
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	f.now = f.now.Add(d)
+	f.mu.Unlock()
+}
+
+// Set sets the clock's current time to now.
+func (f *FakeClock) Set(now time.Time) {
+	f.mu.Lock()
+	f.now = now
+	f.mu.Unlock()
+}
+
+// CoarseClock is a Clock that reads the system clock once every resolution,
+// on a goroutine of its own, rather than on every call to Now. Now then only
+// loads the stored time, which makes it cheaper than time.Now for caches that
+// check expiration times on every Get, at the cost of expiring items up to
+// resolution late. The times it returns have no monotonic clock reading. It
+// is safe for concurrent use.
+type CoarseClock struct {
+	// nanos is first so that it is aligned for atomic access on 32-bit
+	// platforms.
+	nanos    int64
+	stopped  int32
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewCoarseClock returns a CoarseClock that reads the system clock every
+// resolution, which must be positive. Call Stop to stop its goroutine.
+func NewCoarseClock(resolution time.Duration) *CoarseClock {
+	cc := &CoarseClock{
+		nanos: time.Now().UnixNano(),
+		stop:  make(chan struct{}),
+	}
+	go cc.run(resolution)
+	return cc
+}
+
+func (cc *CoarseClock) run(resolution time.Duration) {
+	ticker := time.NewTicker(resolution)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			atomic.StoreInt64(&cc.nanos, now.UnixNano())
+		case <-cc.stop:
+			return
+		}
+	}
+}
+
+// Now returns the system time as of the last tick, or the current system time
+// once the clock has been stopped.
+func (cc *CoarseClock) Now() time.Time {
+	if atomic.LoadInt32(&cc.stopped) != 0 {
+		return time.Now()
+	}
+	return time.Unix(0, atomic.LoadInt64(&cc.nanos))
+}
+
+// Stop stops the clock's goroutine. After Stop, Now reads the system clock on
+// every call, so that a cache still using the clock keeps expiring items. It
+// is safe to call more than once.
+func (cc *CoarseClock) Stop() {
+	cc.stopOnce.Do(func() {
+		atomic.StoreInt32(&cc.stopped, 1)
+		close(cc.stop)
+	})
+}
@@ -0,0 +1,245 @@
+package cache
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2022, 6, 16, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	assert.Equal(t, start, clock.Now())
+	clock.Advance(time.Minute)
+	assert.Equal(t, start.Add(time.Minute), clock.Now())
+	clock.Set(start)
+	assert.Equal(t, start, clock.Now())
+}
+
+func TestCacheWithClock(t *testing.T) {
+	clock := NewFakeClock(time.Date(2022, 6, 16, 0, 0, 0, 0, time.UTC))
+	tc := New[string, int](time.Minute, 0, WithClock[string, int](clock))
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, time.Hour)
+	tc.Set("c", 3, NoExpiration)
+
+	_, exp, found := tc.GetWithExpiration("a")
+	assert.True(t, found)
+	assert.True(t, clock.Now().Add(time.Minute).Equal(exp), "expiration of a is not one minute from now")
+
+	clock.Advance(time.Minute + time.Nanosecond)
+	_, found = tc.Get("a")
+	assert.False(t, found, "a didn't expire")
+	assert.ElementsMatch(t, []string{"b", "c"}, tc.Keys())
+	assert.Len(t, tc.Items(), 2)
+	assert.NoError(t, tc.Add("a", 4, DefaultExpiration))
+
+	clock.Advance(time.Hour)
+	tc.DeleteExpired()
+	assert.Equal(t, []string{"c"}, tc.Keys())
+	assert.Equal(t, 1, tc.ItemCount())
+}
+
+func TestWithExpirationJitter(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	newCache := func(seed int64) *Cache[int, int] {
+		return New[int, int](time.Minute, 0,
+			WithClock[int, int](clock),
+			WithExpirationJitter[int, int](10*time.Second, rand.NewSource(seed)))
+	}
+	tc := newCache(1)
+	distinct := map[time.Time]bool{}
+	for i := 0; i < 100; i++ {
+		tc.Set(i, i, DefaultExpiration)
+		_, exp, _ := tc.GetWithExpiration(i)
+		assert.False(t, exp.Before(start.Add(time.Minute)), "expiration %v is before the TTL", exp)
+		assert.False(t, exp.After(start.Add(time.Minute+10*time.Second)), "expiration %v exceeds the maximum jitter", exp)
+		distinct[exp] = true
+	}
+	assert.Greater(t, len(distinct), 1, "jitter didn't spread expirations")
+
+	tc.Set(100, 100, NoExpiration)
+	_, exp, _ := tc.GetWithExpiration(100)
+	assert.True(t, exp.IsZero(), "NoExpiration item got an expiration")
+
+	// The same seed yields the same expirations
+	tc2 := newCache(1)
+	for i := 0; i < 100; i++ {
+		tc2.Set(i, i, DefaultExpiration)
+		_, exp1, _ := tc.GetWithExpiration(i)
+		_, exp2, _ := tc2.GetWithExpiration(i)
+		assert.True(t, exp1.Equal(exp2))
+	}
+
+	// RenewOrSet sets a new duration too, both when storing and renewing
+	distinct = map[time.Time]bool{}
+	for i := 200; i < 300; i++ {
+		tc.RenewOrSet(i, i, DefaultExpiration)
+		tc.RenewOrSet(i, i, DefaultExpiration)
+		_, exp, _ := tc.GetWithExpiration(i)
+		assert.False(t, exp.Before(start.Add(time.Minute)), "expiration %v is before the TTL", exp)
+		assert.False(t, exp.After(start.Add(time.Minute+10*time.Second)), "expiration %v exceeds the maximum jitter", exp)
+		distinct[exp] = true
+	}
+	assert.Greater(t, len(distinct), 1, "RenewOrSet didn't apply jitter")
+}
+
+func TestWithMaxTTL(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	tc := New[string, int](NoExpiration, 0,
+		WithClock[string, int](clock),
+		WithMaxTTL[string, int](time.Minute))
+
+	tc.Set("forever", 1, NoExpiration)
+	tc.Set("default", 2, DefaultExpiration)
+	tc.Set("long", 3, time.Hour)
+	tc.Set("short", 4, time.Second)
+	assert.NoError(t, tc.Add("added", 5, NoExpiration))
+	tc.Set("replaced", 0, time.Second)
+	assert.NoError(t, tc.Replace("replaced", 6, time.Hour))
+
+	for _, k := range []string{"forever", "default", "long", "added", "replaced"} {
+		_, exp, found := tc.GetWithExpiration(k)
+		assert.True(t, found, k)
+		assert.True(t, exp.Equal(start.Add(time.Minute)), "%s expires at %v", k, exp)
+	}
+	_, exp, _ := tc.GetWithExpiration("short")
+	assert.True(t, exp.Equal(start.Add(time.Second)))
+
+	clock.Advance(time.Minute + time.Second)
+	assert.Equal(t, 0, len(tc.Items()))
+}
+
+func TestSetDefaultExpiration(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	tc := New[string, int](time.Minute, 0, WithClock[string, int](clock))
+	assert.Equal(t, time.Minute, tc.DefaultExpiration())
+	tc.Set("before", 1, DefaultExpiration)
+
+	tc.SetDefaultExpiration(time.Hour)
+	assert.Equal(t, time.Hour, tc.DefaultExpiration())
+	tc.Set("after", 2, DefaultExpiration)
+	_, exp, _ := tc.GetWithExpiration("before")
+	assert.True(t, exp.Equal(start.Add(time.Minute)), "existing item's expiration changed")
+	_, exp, _ = tc.GetWithExpiration("after")
+	assert.True(t, exp.Equal(start.Add(time.Hour)))
+
+	tc.SetDefaultExpiration(0)
+	assert.Equal(t, NoExpiration, tc.DefaultExpiration())
+	tc.Set("forever", 3, DefaultExpiration)
+	_, exp, _ = tc.GetWithExpiration("forever")
+	assert.True(t, exp.IsZero())
+}
+
+func TestTTL(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	tc := New[string, int](DefaultExpiration, 0, WithClock[string, int](clock))
+	tc.Set("a", 1, time.Minute)
+	tc.Set("forever", 2, NoExpiration)
+
+	ttl, found := tc.TTL("a")
+	assert.True(t, found)
+	assert.Equal(t, time.Minute, ttl)
+	clock.Advance(45 * time.Second)
+	ttl, _ = tc.TTL("a")
+	assert.Equal(t, 15*time.Second, ttl)
+	clock.Advance(15 * time.Second)
+	ttl, found = tc.TTL("a")
+	assert.True(t, found)
+	assert.Greater(t, ttl, time.Duration(0))
+	clock.Advance(time.Nanosecond)
+	ttl, found = tc.TTL("a")
+	assert.False(t, found)
+	assert.Equal(t, time.Duration(0), ttl)
+
+	ttl, found = tc.TTL("forever")
+	assert.True(t, found)
+	assert.Equal(t, NoExpiration, ttl)
+
+	_, found = tc.TTL("missing")
+	assert.False(t, found)
+}
+
+func TestSetAbsolute(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	tc := New[string, int](DefaultExpiration, 0, WithClock[string, int](clock))
+	tc.Set("sliding", 1, time.Minute)
+	tc.SetAbsolute("absolute", 2, start.Add(time.Minute))
+	tc.SetAbsolute("forever", 3, time.Time{})
+	tc.SetAbsolute("past", 4, start.Add(-time.Second))
+
+	_, exp, _ := tc.GetWithExpiration("absolute")
+	assert.True(t, exp.Equal(start.Add(time.Minute)))
+	_, exp, _ = tc.GetWithExpiration("forever")
+	assert.True(t, exp.IsZero())
+	_, found := tc.Get("past")
+	assert.False(t, found)
+
+	clock.Advance(30 * time.Second)
+	_, found = tc.GetSliding("sliding")
+	assert.True(t, found)
+	_, found = tc.GetSliding("absolute")
+	assert.True(t, found)
+	clock.Advance(31 * time.Second)
+	_, found = tc.Get("sliding")
+	assert.True(t, found, "sliding item wasn't extended")
+	_, found = tc.Get("absolute")
+	assert.False(t, found, "absolute item was extended")
+
+	tc = New[string, int](DefaultExpiration, 0, WithClock[string, int](clock), WithMaxTTL[string, int](time.Minute))
+	tc.SetAbsolute("forever", 3, time.Time{})
+	_, exp, _ = tc.GetWithExpiration("forever")
+	assert.True(t, exp.Equal(clock.Now().Add(time.Minute)))
+}
+
+func TestCoarseClock(t *testing.T) {
+	clock := NewCoarseClock(time.Hour)
+	defer clock.Stop()
+	now := clock.Now()
+	assert.WithinDuration(t, time.Now(), now, time.Second)
+	<-time.After(2 * time.Millisecond)
+	assert.Equal(t, now, clock.Now())
+
+	clock = NewCoarseClock(time.Millisecond)
+	now = clock.Now()
+	assert.Eventually(t, func() bool {
+		return clock.Now().After(now)
+	}, time.Second, time.Millisecond)
+
+	clock.Stop()
+	clock.Stop()
+	now = clock.Now()
+	<-time.After(2 * time.Millisecond)
+	assert.True(t, clock.Now().After(now))
+}
+
+func TestWithCoarseClock(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0, WithCoarseClock[string, int](time.Millisecond))
+	assert.NotNil(t, tc.coarse)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, 5*time.Millisecond)
+	v, found := tc.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, 1, v)
+	assert.Eventually(t, func() bool {
+		_, found := tc.Get("b")
+		return !found
+	}, time.Second, time.Millisecond)
+
+	clock := tc.coarse
+	tc.Close()
+	assert.Nil(t, tc.coarse)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&clock.stopped))
+	tc.Set("c", 3, 5*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		_, found := tc.Get("c")
+		return !found
+	}, time.Second, time.Millisecond)
+}
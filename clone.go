@@ -0,0 +1,79 @@
+package cache
+
+import "time"
+
+// Clone returns a new cache holding copies of the unexpired items in c, with
+// the same default expiration, cleanup interval and options (such as
+// WithMaxItems, WithClock or WithLoader, but not WithWriteBehind) as c. The
+// clone has its own items map, lock and janitor, so changes to either cache
+// don't affect the other.
+//
+// The items' values are copied by assignment, so a value that is or contains a
+// pointer, slice or map still refers to the same data in both caches. The
+// clone starts without any eviction callbacks, event subscribers, negative
+// entries or statistics, and its items don't carry the cleanup functions set
+// with SetWithCleanup, so that a resource isn't cleaned up twice. The recency
+// or frequency of use of the items isn't copied either.
+func (c *Cache[K, T]) Clone() *Cache[K, T] {
+	c.mu.RLock()
+	items := make(map[K]Item[T], len(c.items))
+	now := c.now().UnixNano()
+	for k, v := range c.items {
+		// "Inlining" of expired
+		if v.Expiration > 0 && now > v.Expiration {
+			continue
+		}
+		items[k] = v
+	}
+	var ci time.Duration
+	if c.janitor != nil {
+		ci = c.janitor.Interval
+	}
+	c.mu.RUnlock()
+	return newCacheWithJanitor(c.DefaultExpiration(), ci, items, c.cloneOptions)
+}
+
+// cloneOptions copies the configuration set by c's options to nc.
+func (c *cache[K, T]) cloneOptions(nc *cache[K, T]) {
+	nc.clock = c.clock
+	nc.maxItems = c.maxItems
+	nc.maxBytes = c.maxBytes
+	nc.sizer = c.sizer
+	nc.newPolicy = c.newPolicy
+	nc.loader = c.loader
+	if c.loadLimit != nil {
+		nc.loadLimit = newLoadLimiter(cap(c.loadLimit.slots))
+	}
+	nc.maxJitter = c.maxJitter
+	nc.jitterRand = c.jitterRand
+	nc.maxTTL = c.maxTTL
+	nc.errorTTL = c.errorTTL
+	nc.observer = c.observer
+	nc.onPanic = c.onPanic
+	if c.values != nil {
+		nc.values = newValueCounts(c.values.hash)
+	}
+	nc.expireBatch = c.expireBatch
+	nc.adaptive = c.adaptive
+	nc.inspector = c.inspector
+	nc.validator = c.validator
+	if c.oplog != nil {
+		nc.oplog = newOpLog[K](len(c.oplog.ops))
+	}
+	nc.logReads = c.logReads
+	if c.refresh != nil {
+		nc.refresh = newRefreshAhead(c.refresh.window, c.refresh.reload)
+	}
+	if c.cow != nil {
+		withCOW[K, T]()(nc)
+	}
+	if c.heap != nil {
+		nc.heap = newHeapWatcher[K, T](c.heap.threshold, c.heap.interval)
+	}
+	if c.async != nil {
+		nc.async = newDispatcher(c.async.max)
+	}
+	if c.expiredCh != nil {
+		nc.expiredCh = make(chan KeyValue[K, T], cap(c.expiredCh))
+	}
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClone(t *testing.T) {
+	tc := New[string, []int](time.Hour, 0, WithMaxItems[string, []int](3))
+	tc.Set("a", []int{1}, DefaultExpiration)
+	tc.Set("b", []int{2}, NoExpiration)
+	tc.Set("expired", []int{3}, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+
+	cc := tc.Clone()
+	assert.ElementsMatch(t, []string{"a", "b"}, cc.Keys())
+	assert.Equal(t, time.Hour, cc.DefaultExpiration())
+	_, exp1, _ := tc.GetWithExpiration("a")
+	_, exp2, _ := cc.GetWithExpiration("a")
+	assert.True(t, exp1.Equal(exp2))
+
+	// Values are copied shallowly
+	x, _ := tc.Get("a")
+	x[0] = 42
+	y, _ := cc.Get("a")
+	assert.Equal(t, 42, y[0])
+
+	cc.Set("c", []int{4}, DefaultExpiration)
+	cc.Set("d", []int{5}, DefaultExpiration)
+	assert.Equal(t, 3, cc.ItemCount(), "the clone doesn't keep the original's item limit")
+	cc.Delete("b")
+	_, found := tc.Get("b")
+	assert.True(t, found, "deleting from the clone affected the original")
+	_, found = tc.Get("c")
+	assert.False(t, found, "setting in the clone affected the original")
+
+}
+
+func TestCloneJanitor(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, time.Millisecond)
+	defer tc.Close()
+	cc := tc.Clone()
+	defer cc.Close()
+	if assert.NotNil(t, cc.janitor) {
+		assert.NotSame(t, tc.janitor, cc.janitor)
+		assert.Equal(t, time.Millisecond, cc.janitor.Interval)
+	}
+
+	ec := New[string, int](DefaultExpiration, 0).Clone()
+	assert.Nil(t, ec.janitor)
+}
+
+func TestCloneCleanup(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	calls := 0
+	tc.SetWithCleanup("a", 1, DefaultExpiration, func(int) {
+		calls++
+	})
+	cc := tc.Clone()
+	cc.Delete("a")
+	assert.Equal(t, 0, calls)
+	tc.Delete("a")
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,350 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// call is an in-flight (or completed) computation of a single key. Waiters
+// block on done and then read val and err, which are only written before done
+// is closed.
+type call[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+	// waiters and cancel are protected by the cache's flightMu. waiters
+	// counts the callers waiting for the computation that haven't given up,
+	// whichever method they called, since a key's computation is shared by
+	// all of them. cancel is only set for loads that can be abandoned,
+	// started by GetOrLoadContext or GetContext, and is called once every
+	// waiter has given up.
+	waiters int
+	cancel  context.CancelFunc
+	// keepErr is set for computations whose error mustn't be remembered
+	// by WithErrorCaching, see Memoize.
+	keepErr bool
+}
+
+// cachedError is an error returned by a computation, which is remembered until
+// its expiration time when WithErrorCaching is used.
+type cachedError struct {
+	err        error
+	expiration int64
+}
+
+// GetOrCompute returns the item for the given key if it is present and hasn't
+// expired. Otherwise fn is called to compute it, and a successful result is
+// stored with the duration d (see Set for the meaning of d) and returned.
+//
+// Only one goroutine runs fn for a given key at a time; concurrent callers
+// asking for the same key wait for that computation and receive its result.
+// If fn returns an error nothing is stored and every waiter receives the
+// error. If fn panics, the panic propagates to the goroutine that called fn
+// and the waiters receive an error instead.
+//
+// If the cache was created with WithErrorCaching, an error returned by fn is
+// returned again, without calling fn, until it expires.
+func (c *cache[K, T]) GetOrCompute(k K, d time.Duration, fn func() (T, error)) (T, error) {
+	return c.GetOrComputeTimeout(k, d, 0, fn)
+}
+
+// GetOrComputeTimeout is like GetOrCompute, but if another goroutine is
+// already computing the item, it waits at most timeout for the result. If the
+// computation hasn't finished by then, GetOrComputeTimeout returns an error
+// wrapping ErrTimeout, and the computation carries on, storing its result for
+// later callers. A computation started by GetOrComputeTimeout itself runs fn
+// on the calling goroutine, so it isn't bounded by timeout. If timeout is less
+// than one, it waits as long as GetOrCompute does.
+func (c *cache[K, T]) GetOrComputeTimeout(k K, d, timeout time.Duration, fn func() (T, error)) (T, error) {
+	return c.compute(k, d, timeout, true, fn)
+}
+
+// Memoize returns the item for the given key if it is present and hasn't
+// expired. Otherwise fn is called to compute it, and a successful result is
+// stored without an expiration time (but subject to WithMaxTTL) and returned,
+// so that fn runs successfully at most once per key for as long as the item
+// isn't deleted or evicted. Like GetOrCompute, concurrent callers asking for
+// the same key share a single call of fn. Unlike GetOrCompute, an error
+// returned by fn is never remembered with WithErrorCaching, so the next call
+// retries the computation.
+func (c *cache[K, T]) Memoize(k K, fn func() (T, error)) (T, error) {
+	return c.compute(k, NoExpiration, 0, false, fn)
+}
+
+// compute implements GetOrComputeTimeout and Memoize. Errors are remembered
+// with WithErrorCaching only if cacheErr is true.
+func (c *cache[K, T]) compute(k K, d, timeout time.Duration, cacheErr bool, fn func() (T, error)) (T, error) {
+	if v, found := c.Peek(k); found {
+		return v, nil
+	}
+	if cacheErr {
+		if err := c.cachedErr(k); err != nil {
+			return *new(T), err
+		}
+	}
+	c.flightMu.Lock()
+	if fl, ok := c.flights[k]; ok {
+		fl.waiters++
+		c.flightMu.Unlock()
+		if timeout > 0 {
+			return c.waitTimeout(k, fl, timeout)
+		}
+		<-fl.done
+		return fl.val, fl.err
+	}
+	// Another goroutine may have stored the item since Get
+	if v, found := c.Peek(k); found {
+		c.flightMu.Unlock()
+		return v, nil
+	}
+	fl := c.newCall(k)
+	fl.keepErr = !cacheErr
+	c.flightMu.Unlock()
+	c.doCall(k, fl, func() (T, time.Duration, error) {
+		v, err := fn()
+		return v, d, err
+	})
+	return fl.val, fl.err
+}
+
+// waitTimeout waits at most timeout for the computation fl of k to finish.
+// Giving up counts as a waiter leaving fl, as it does for GetOrLoadContext.
+func (c *cache[K, T]) waitTimeout(k K, fl *call[T], timeout time.Duration) (T, error) {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-fl.done:
+		return fl.val, fl.err
+	case <-t.C:
+	}
+	// Prefer a result that arrived together with the timeout
+	select {
+	case <-fl.done:
+		return fl.val, fl.err
+	default:
+		c.flightMu.Lock()
+		fl.waiters--
+		if fl.waiters == 0 && fl.cancel != nil {
+			fl.cancel()
+		}
+		c.flightMu.Unlock()
+		return *new(T), fmt.Errorf("%w: %v", ErrTimeout, k)
+	}
+}
+
+// GetOrLoadContext is like GetOrCompute, but the load function receives a
+// context and waiting for it can be canceled. If ctx is done before the item
+// has been loaded, GetOrLoadContext returns ctx.Err().
+//
+// The load runs on its own goroutine with a context that carries the values
+// of the ctx it was started with, but which is only canceled once every
+// caller waiting for it has given up, so one waiter canceling doesn't abort
+// the load for the others. A successful result is stored even if all waiters
+// have given up. If fn panics, the panic is recovered and the waiters receive
+// an error instead.
+func (c *cache[K, T]) GetOrLoadContext(ctx context.Context, k K, d time.Duration, fn func(context.Context) (T, error)) (T, error) {
+	if v, found := c.Peek(k); found {
+		return v, nil
+	}
+	if err := c.cachedErr(k); err != nil {
+		return *new(T), err
+	}
+	c.flightMu.Lock()
+	fl, ok := c.flights[k]
+	if !ok {
+		// Another goroutine may have stored the item since Get
+		if v, found := c.Peek(k); found {
+			c.flightMu.Unlock()
+			return v, nil
+		}
+		fl = c.newCall(k)
+		loadCtx, cancel := context.WithCancel(detachedContext{ctx})
+		fl.cancel = cancel
+		go func() {
+			defer func() {
+				// doCall has already reported the panic to the waiters
+				_ = recover()
+			}()
+			defer cancel()
+			c.doCall(k, fl, func() (T, time.Duration, error) {
+				v, err := fn(loadCtx)
+				return v, d, err
+			})
+		}()
+	}
+	fl.waiters++
+	c.flightMu.Unlock()
+
+	select {
+	case <-fl.done:
+		return fl.val, fl.err
+	case <-ctx.Done():
+		c.flightMu.Lock()
+		fl.waiters--
+		if fl.waiters == 0 && fl.cancel != nil {
+			fl.cancel()
+		}
+		c.flightMu.Unlock()
+		return *new(T), ctx.Err()
+	}
+}
+
+// loadThrough loads a missing item with the cache's loader, coalescing
+// concurrent loads of the same key like GetOrCompute. If ctx can be canceled,
+// the load runs on its own goroutine like one started by GetOrLoadContext, so
+// that the caller that started it giving up doesn't fail the others waiting
+// for it; it is only abandoned, while waiting for a slot of
+// WithLoaderConcurrency, once every waiter has given up.
+func (c *cache[K, T]) loadThrough(ctx context.Context, k K) (T, bool) {
+	if c.cachedErr(k) != nil {
+		return *new(T), false
+	}
+	c.flightMu.Lock()
+	fl, ok := c.flights[k]
+	if !ok {
+		// Another goroutine may have stored the item since Peek
+		c.mu.RLock()
+		v, found := c.get(k)
+		c.mu.RUnlock()
+		if found {
+			c.flightMu.Unlock()
+			return v, true
+		}
+		fl = c.newCall(k)
+		if ctx.Done() == nil {
+			// Nobody can give up on the load, so it runs on the calling
+			// goroutine, and a panic of the loader propagates to it
+			c.flightMu.Unlock()
+			c.doCall(k, fl, func() (T, time.Duration, error) {
+				return c.callLoader(ctx, k)
+			})
+			return fl.val, fl.err == nil
+		}
+		loadCtx, cancel := context.WithCancel(detachedContext{ctx})
+		fl.cancel = cancel
+		go func() {
+			defer func() {
+				// doCall has already reported the panic to the waiters
+				_ = recover()
+			}()
+			defer cancel()
+			c.doCall(k, fl, func() (T, time.Duration, error) {
+				v, d, err := c.callLoader(loadCtx, k)
+				if err != nil && err == loadCtx.Err() {
+					// Giving up waiting for a load slot isn't an error of
+					// the loader to remember
+					fl.keepErr = true
+				}
+				return v, d, err
+			})
+		}()
+	}
+	fl.waiters++
+	c.flightMu.Unlock()
+
+	select {
+	case <-fl.done:
+		return fl.val, fl.err == nil
+	case <-ctx.Done():
+		c.flightMu.Lock()
+		fl.waiters--
+		if fl.waiters == 0 && fl.cancel != nil {
+			fl.cancel()
+		}
+		c.flightMu.Unlock()
+		return *new(T), false
+	}
+}
+
+// detachedContext carries the values of its parent, but is never canceled and
+// has no deadline.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (d detachedContext) Value(key any) any {
+	return d.parent.Value(key)
+}
+
+// newCall registers an in-flight computation for k. flightMu must be held.
+func (c *cache[K, T]) newCall(k K) *call[T] {
+	fl := &call[T]{done: make(chan struct{})}
+	if c.flights == nil {
+		c.flights = make(map[K]*call[T])
+	}
+	c.flights[k] = fl
+	return fl
+}
+
+// doCall runs fn for k, stores a successful result with the duration returned
+// by fn and releases the waiters, even if fn panics.
+func (c *cache[K, T]) doCall(k K, fl *call[T], fn func() (T, time.Duration, error)) {
+	normalReturn := false
+	defer func() {
+		if !normalReturn {
+			fl.val = *new(T)
+			fl.err = fmt.Errorf("computing item %v panicked", k)
+		}
+		c.flightMu.Lock()
+		delete(c.flights, k)
+		c.flightMu.Unlock()
+		close(fl.done)
+	}()
+	var d time.Duration
+	fl.val, d, fl.err = fn()
+	if fl.err == nil {
+		c.Set(k, fl.val, d)
+	} else if c.errorTTL > 0 && !fl.keepErr {
+		c.cacheError(k, fl.err)
+	}
+	normalReturn = true
+}
+
+// cacheError remembers err as the result of computing k for the duration set
+// with WithErrorCaching.
+func (c *cache[K, T]) cacheError(k K, err error) {
+	e := c.now().Add(c.errorTTL).UnixNano()
+	c.mu.Lock()
+	if c.errs == nil {
+		c.errs = make(map[K]cachedError)
+	}
+	c.errs[k] = cachedError{err, e}
+	c.mu.Unlock()
+}
+
+// cachedErr returns the unexpired error remembered for k by cacheError, or nil
+// if there is none.
+func (c *cache[K, T]) cachedErr(k K) error {
+	if c.errorTTL <= 0 {
+		return nil
+	}
+	c.mu.RLock()
+	ce, found := c.errs[k]
+	c.mu.RUnlock()
+	if !found || c.now().UnixNano() > ce.expiration {
+		return nil
+	}
+	return ce.err
+}
+
+// deleteExpiredErrors removes expired cached errors. c.mu must be held.
+func (c *cache[K, T]) deleteExpiredErrors(now int64) {
+	for k, ce := range c.errs {
+		if now > ce.expiration {
+			delete(c.errs, k)
+		}
+	}
+}
@@ -0,0 +1,543 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetOrCompute(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	v, err := tc.GetOrCompute("foo", DefaultExpiration, func() (int, error) {
+		return 1, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+
+	v, err = tc.GetOrCompute("foo", DefaultExpiration, func() (int, error) {
+		t.Error("fn was called for a cached key")
+		return 2, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+}
+
+func TestGetOrComputeConcurrent(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	var calls int32
+	release := make(chan struct{})
+	wg := new(sync.WaitGroup)
+	results := make([]int, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := tc.GetOrCompute("foo", DefaultExpiration, func() (int, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return 42, nil
+			})
+			assert.NoError(t, err)
+			results[i] = v
+		}(i)
+	}
+	<-time.After(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for _, v := range results {
+		assert.Equal(t, 42, v)
+	}
+}
+
+func TestGetOrComputeTimeout(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	leaderDone := make(chan struct{})
+	go func() {
+		defer close(leaderDone)
+		v, err := tc.GetOrComputeTimeout("foo", DefaultExpiration, time.Millisecond, func() (int, error) {
+			close(started)
+			<-release
+			return 42, nil
+		})
+		assert.NoError(t, err, "the leader timed out")
+		assert.Equal(t, 42, v)
+	}()
+	<-started
+	_, err := tc.GetOrComputeTimeout("foo", DefaultExpiration, 10*time.Millisecond, func() (int, error) {
+		t.Error("fn was called while another computation was in flight")
+		return 0, nil
+	})
+	assert.ErrorIs(t, err, ErrTimeout)
+
+	// The leader finishes after the waiter has given up, and still stores
+	// its result.
+	close(release)
+	<-leaderDone
+	v, err := tc.GetOrComputeTimeout("foo", DefaultExpiration, time.Millisecond, func() (int, error) {
+		t.Error("fn was called for a cached key")
+		return 0, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 42, v)
+}
+
+func TestGetOrComputeTimeoutLeavesFlight(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go tc.GetOrLoadContext(ctx, "foo", DefaultExpiration, func(ctx context.Context) (int, error) {
+		close(started)
+		<-ctx.Done()
+		close(canceled)
+		return 0, ctx.Err()
+	})
+	<-started
+	_, err := tc.GetOrComputeTimeout("foo", DefaultExpiration, time.Millisecond, func() (int, error) {
+		t.Error("fn was called while another computation was in flight")
+		return 0, nil
+	})
+	assert.ErrorIs(t, err, ErrTimeout)
+
+	// The waiter that timed out no longer keeps the load alive
+	cancel()
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the load wasn't canceled once every waiter had given up")
+	}
+}
+
+func TestGetOrComputeTimeoutRace(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	// A result that is ready when the timeout fires wins.
+	fl := &call[int]{done: make(chan struct{}), val: 42}
+	close(fl.done)
+	for i := 0; i < 100; i++ {
+		v, err := tc.waitTimeout("foo", fl, time.Nanosecond)
+		assert.NoError(t, err)
+		assert.Equal(t, 42, v)
+	}
+
+	// Leaders finishing around the timeout either deliver their result or
+	// time out the waiter, and always store the result.
+	for i := 0; i < 20; i++ {
+		started := make(chan struct{})
+		go tc.GetOrCompute("foo", DefaultExpiration, func() (int, error) {
+			close(started)
+			time.Sleep(time.Millisecond)
+			return i, nil
+		})
+		<-started
+		v, err := tc.GetOrComputeTimeout("foo", DefaultExpiration, time.Millisecond, func() (int, error) {
+			return -1, nil
+		})
+		if err != nil {
+			assert.ErrorIs(t, err, ErrTimeout)
+		} else {
+			assert.Equal(t, i, v)
+		}
+		assert.Eventually(t, func() bool {
+			v, found := tc.Get("foo")
+			return found && v == i
+		}, time.Second, time.Millisecond)
+		tc.Delete("foo")
+	}
+}
+
+func TestGetOrComputeError(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	errBoom := errors.New("boom")
+	_, err := tc.GetOrCompute("foo", DefaultExpiration, func() (int, error) {
+		return 0, errBoom
+	})
+	assert.ErrorIs(t, err, errBoom)
+	_, found := tc.Get("foo")
+	assert.False(t, found, "foo was stored even though fn failed")
+}
+
+func TestGetOrComputePanic(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	func() {
+		defer func() {
+			assert.NotNil(t, recover())
+		}()
+		_, _ = tc.GetOrCompute("foo", DefaultExpiration, func() (int, error) {
+			panic("boom")
+		})
+	}()
+
+	v, err := tc.GetOrCompute("foo", DefaultExpiration, func() (int, error) {
+		return 1, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+}
+
+func TestMemoize(t *testing.T) {
+	tc := New[string, int](time.Minute, 0, WithErrorCaching[string, int](time.Hour))
+	errBoom := errors.New("boom")
+	_, err := tc.Memoize("foo", func() (int, error) {
+		return 0, errBoom
+	})
+	assert.ErrorIs(t, err, errBoom)
+
+	v, err := tc.Memoize("foo", func() (int, error) {
+		return 1, nil
+	})
+	assert.NoError(t, err, "the error was remembered")
+	assert.Equal(t, 1, v)
+	_, exp, found := tc.GetWithExpiration("foo")
+	assert.True(t, found)
+	assert.True(t, exp.IsZero(), "the memoized item expires")
+
+	v, err = tc.Memoize("foo", func() (int, error) {
+		t.Error("fn was called for a memoized key")
+		return 2, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+}
+
+func TestMemoizeConcurrent(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	var calls int32
+	release := make(chan struct{})
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := tc.Memoize("foo", func() (int, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return 42, nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, 42, v)
+		}()
+	}
+	<-time.After(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestGetOrLoadContext(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	v, err := tc.GetOrLoadContext(context.Background(), "foo", DefaultExpiration, func(ctx context.Context) (int, error) {
+		return 1, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+	x, found := tc.Get("foo")
+	assert.True(t, found)
+	assert.Equal(t, 1, x)
+}
+
+func TestGetOrLoadContextWaiterCanceled(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	fn := func(ctx context.Context) (int, error) {
+		close(started)
+		select {
+		case <-release:
+			return 42, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		_, err := tc.GetOrLoadContext(ctx, "foo", DefaultExpiration, fn)
+		errc <- err
+	}()
+	<-started
+
+	resc := make(chan int)
+	go func() {
+		v, err := tc.GetOrLoadContext(context.Background(), "foo", DefaultExpiration, fn)
+		assert.NoError(t, err)
+		resc <- v
+	}()
+
+	// Wait for the second caller to join the in-flight load
+	for {
+		tc.flightMu.Lock()
+		waiters := tc.flights["foo"].waiters
+		tc.flightMu.Unlock()
+		if waiters == 2 {
+			break
+		}
+		<-time.After(time.Millisecond)
+	}
+
+	cancel()
+	assert.ErrorIs(t, <-errc, context.Canceled)
+	close(release)
+	assert.Equal(t, 42, <-resc)
+}
+
+func TestGetOrLoadContextAllWaitersCanceled(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	loadErr := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := tc.GetOrLoadContext(ctx, "foo", DefaultExpiration, func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		loadErr <- ctx.Err()
+		return 0, ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, <-loadErr, context.Canceled, "load wasn't canceled once nobody waited for it")
+}
+
+func TestWithLoader(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	var calls int32
+	tc := New[string, int](DefaultExpiration, 0,
+		WithClock[string, int](clock),
+		WithLoader(func(k string) (int, time.Duration, error) {
+			atomic.AddInt32(&calls, 1)
+			if k == "bad" {
+				return 0, time.Minute, errors.New("boom")
+			}
+			return len(k), time.Minute, nil
+		}))
+
+	_, found := tc.Peek("foo")
+	assert.False(t, found, "Peek loaded a missing item")
+
+	v, found := tc.Get("foo")
+	assert.True(t, found)
+	assert.Equal(t, 3, v)
+	v, found = tc.Peek("foo")
+	assert.True(t, found)
+	assert.Equal(t, 3, v)
+	_, exp, _ := tc.GetWithExpiration("foo")
+	assert.True(t, exp.Equal(clock.Now().Add(time.Minute)))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	clock.Advance(2 * time.Minute)
+	v, found = tc.Get("foo")
+	assert.True(t, found)
+	assert.Equal(t, 3, v)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "expired item was not reloaded")
+
+	_, found = tc.Get("bad")
+	assert.False(t, found)
+	_, found = tc.Peek("bad")
+	assert.False(t, found, "failed load was stored")
+
+	v, err := tc.GetOrCompute("other", DefaultExpiration, func() (int, error) {
+		return 42, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 42, v, "GetOrCompute used the loader instead of fn")
+}
+
+func TestWithLoaderConcurrent(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	tc := New[string, int](DefaultExpiration, 0,
+		WithLoader(func(k string) (int, time.Duration, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return 42, DefaultExpiration, nil
+		}))
+	wg := new(sync.WaitGroup)
+	results := make([]int, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = tc.Get("foo")
+		}(i)
+	}
+	<-time.After(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for _, v := range results {
+		assert.Equal(t, 42, v)
+	}
+}
+
+func TestWithLoaderConcurrency(t *testing.T) {
+	release := make(chan struct{})
+	var running, peak int32
+	tc := New[int, int](DefaultExpiration, 0,
+		WithLoader(func(k int) (int, time.Duration, error) {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			<-release
+			return k * 10, DefaultExpiration, nil
+		}),
+		WithLoaderConcurrency[int, int](2))
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, found := tc.Get(i)
+			assert.True(t, found)
+			assert.Equal(t, i*10, v)
+		}(i)
+	}
+	assert.Eventually(t, func() bool {
+		stats := tc.Stats()
+		return stats.LoaderRunning == 2 && stats.LoaderQueued == 3
+	}, time.Second, time.Millisecond)
+
+	// A canceled waiter leaves the queue without calling the loader
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() {
+		_, found := tc.GetContext(ctx, 99)
+		done <- found
+	}()
+	assert.Eventually(t, func() bool {
+		return tc.Stats().LoaderQueued == 4
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.False(t, <-done)
+	assert.Eventually(t, func() bool {
+		return tc.Stats().LoaderQueued == 3
+	}, time.Second, time.Millisecond)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+	assert.Equal(t, 0, tc.Stats().LoaderQueued)
+	assert.False(t, tc.Contains(99))
+}
+
+func TestGetContextLeaderCanceled(t *testing.T) {
+	release := make(chan struct{})
+	tc := New[int, int](DefaultExpiration, 0,
+		WithLoader(func(k int) (int, time.Duration, error) {
+			<-release
+			return k * 10, DefaultExpiration, nil
+		}),
+		WithLoaderConcurrency[int, int](1))
+	// Take the only slot, so that the load of 2 waits for one
+	go tc.Get(1)
+	assert.Eventually(t, func() bool {
+		return tc.Stats().LoaderRunning == 1
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan bool)
+	go func() {
+		_, found := tc.GetContext(ctx, 2)
+		leader <- found
+	}()
+	assert.Eventually(t, func() bool {
+		return tc.Stats().LoaderQueued == 1
+	}, time.Second, time.Millisecond)
+	follower := make(chan int)
+	go func() {
+		v, _ := tc.GetContext(context.Background(), 2)
+		follower <- v
+	}()
+	assert.Eventually(t, func() bool {
+		tc.flightMu.Lock()
+		defer tc.flightMu.Unlock()
+		return tc.flights[2] != nil && tc.flights[2].waiters == 2
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	assert.False(t, <-leader)
+	close(release)
+	assert.Equal(t, 20, <-follower)
+	v, found := tc.Peek(2)
+	assert.True(t, found)
+	assert.Equal(t, 20, v)
+}
+
+func TestWithErrorCaching(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	tc := New[string, int](DefaultExpiration, 0,
+		WithClock[string, int](clock),
+		WithErrorCaching[string, int](time.Second))
+	errBoom := errors.New("boom")
+	calls := 0
+	fail := func() (int, error) {
+		calls++
+		return 0, errBoom
+	}
+	succeed := func() (int, error) {
+		calls++
+		return 42, nil
+	}
+
+	_, err := tc.GetOrCompute("foo", DefaultExpiration, fail)
+	assert.ErrorIs(t, err, errBoom)
+	_, err = tc.GetOrCompute("foo", DefaultExpiration, succeed)
+	assert.ErrorIs(t, err, errBoom, "cached error wasn't returned")
+	assert.Equal(t, 1, calls)
+	_, found := tc.Peek("foo")
+	assert.False(t, found, "error was stored as an item")
+
+	clock.Advance(2 * time.Second)
+	v, err := tc.GetOrCompute("foo", DefaultExpiration, succeed)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, v)
+	assert.Equal(t, 2, calls)
+
+	_, err = tc.GetOrCompute("bar", DefaultExpiration, fail)
+	assert.ErrorIs(t, err, errBoom)
+	tc.Set("bar", 1, DefaultExpiration)
+	tc.Delete("bar")
+	v, err = tc.GetOrCompute("bar", DefaultExpiration, succeed)
+	assert.NoError(t, err, "storing a value didn't forget the cached error")
+	assert.Equal(t, 42, v)
+
+	_, err = tc.GetOrCompute("baz", DefaultExpiration, fail)
+	assert.ErrorIs(t, err, errBoom)
+	clock.Advance(2 * time.Second)
+	tc.DeleteExpired()
+	assert.Empty(t, tc.errs)
+}
+
+func TestWithLoaderErrorCaching(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	calls := 0
+	tc := New[string, int](DefaultExpiration, 0,
+		WithClock[string, int](clock),
+		WithErrorCaching[string, int](time.Second),
+		WithLoader(func(k string) (int, time.Duration, error) {
+			calls++
+			if calls == 1 {
+				return 0, DefaultExpiration, errors.New("boom")
+			}
+			return 42, DefaultExpiration, nil
+		}))
+	_, found := tc.Get("foo")
+	assert.False(t, found)
+	_, found = tc.Get("foo")
+	assert.False(t, found)
+	assert.Equal(t, 1, calls)
+
+	clock.Advance(2 * time.Second)
+	v, found := tc.Get("foo")
+	assert.True(t, found)
+	assert.Equal(t, 42, v)
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cacheMutex is the lock protecting a cache's items. For a cache created with
+// NewCOW, releasing the write lock calls publish if the items were changed
+// while it was held, so that every change to the items is published for
+// readers that don't take the lock.
+type cacheMutex struct {
+	sync.RWMutex
+	publish func()
+	// changed is set by every change to the items, while holding the write
+	// lock.
+	changed bool
+}
+
+func (m *cacheMutex) Unlock() {
+	if m.changed {
+		if m.publish != nil {
+			m.publish()
+		}
+		m.changed = false
+	}
+	m.RWMutex.Unlock()
+}
+
+// NewCOW returns a new cache like New, for workloads that read much more than
+// they write. Get and Peek read the items from an immutable copy of them,
+// without taking the cache's lock, while every write copies all items into a
+// new map and publishes it. Writes therefore take O(n) time and allocate a
+// map of n items, where n is the number of items in the cache, and the cache
+// holds up to twice as many items in memory; in return, reads never wait for
+// writers or contend with each other.
+//
+// Because Get and Peek don't take the lock, they don't record the use of items
+// for an eviction policy set with WithMaxItems or WithMaxBytes, which then
+// evicts by insertion order rather than recency or frequency of use.
+func NewCOW[K comparable, T any](defaultExpiration, cleanupInterval time.Duration, opts ...Option[K, T]) *Cache[K, T] {
+	items := make(map[K]Item[T])
+	return newCacheWithJanitor[K, T](defaultExpiration, cleanupInterval, items, append(opts, withCOW[K, T]())...)
+}
+
+// withCOW makes the cache publish a copy of its items after every write, see
+// NewCOW.
+func withCOW[K comparable, T any]() Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.cow = new(atomic.Value)
+		c.mu.publish = c.publishItems
+	}
+}
+
+// publishItems stores a copy of the items for cowPeek. c.mu must be held.
+func (c *cache[K, T]) publishItems() {
+	items := make(map[K]Item[T], len(c.items))
+	for k, v := range c.items {
+		items[k] = v
+	}
+	c.cow.Store(items)
+}
+
+// cowPeek is Peek for a cache created with NewCOW.
+func (c *cache[K, T]) cowPeek(k K) (T, bool) {
+	items, _ := c.cow.Load().(map[K]Item[T])
+	item, found := items[k]
+	if !found || c.expired(item) {
+		c.miss(k)
+		return *new(T), false
+	}
+	c.hit(k)
+	return item.Object, true
+}
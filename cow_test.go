@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCOW(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	tc := NewCOW[string, int](DefaultExpiration, 0, WithClock[string, int](clock))
+
+	_, found := tc.Get("a")
+	assert.False(t, found)
+
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, time.Second)
+	v, found := tc.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, 1, v)
+
+	tc.Delete("a")
+	_, found = tc.Get("a")
+	assert.False(t, found)
+
+	clock.Advance(2 * time.Second)
+	_, found = tc.Get("b")
+	assert.False(t, found)
+
+	tc.SwapItems(map[string]Item[int]{}, false)
+	tc.Set("c", 3, DefaultExpiration)
+	cc := tc.Clone()
+	v, found = cc.Get("c")
+	assert.True(t, found)
+	assert.Equal(t, 3, v)
+	cc.Set("d", 4, DefaultExpiration)
+	v, found = cc.Get("d")
+	assert.True(t, found)
+	assert.Equal(t, 4, v)
+
+	stats := tc.Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(3), stats.Misses)
+}
+
+func TestNewCOWPublishesChanges(t *testing.T) {
+	tc := NewCOW[string, int](DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	published := func() uintptr {
+		return reflect.ValueOf(tc.cow.Load()).Pointer()
+	}
+	p := published()
+
+	// Writes that don't change any item don't copy the items
+	tc.DeleteExpired()
+	assert.False(t, tc.Touch("missing", time.Minute))
+	tc.OnEvicted(func(string, int) {})
+	tc.Delete("missing")
+	assert.Equal(t, p, published())
+
+	assert.True(t, tc.Touch("a", time.Minute))
+	assert.NotEqual(t, p, published())
+	_, exp, _ := tc.GetWithExpiration("a")
+	items, _ := tc.cow.Load().(map[string]Item[int])
+	assert.Equal(t, exp.UnixNano(), items["a"].Expiration)
+}
+
+func TestNewCOWConcurrent(t *testing.T) {
+	tc := NewCOW[string, int](DefaultExpiration, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tc.Set(strconv.Itoa(i*100+j), j, DefaultExpiration)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if v, found := tc.Get(strconv.Itoa(i*100 + j)); found {
+					assert.Equal(t, j, v)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < 400; i++ {
+		v, found := tc.Get(strconv.Itoa(i))
+		assert.True(t, found)
+		assert.Equal(t, i%100, v)
+	}
+}
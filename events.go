@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// EventType describes the kind of change an Event reports.
+type EventType int
+
+const (
+	// EventSet means an item was stored, e.g. by Set, Add or Replace.
+	EventSet EventType = iota
+	// EventDelete means an item was removed, e.g. by Delete, or evicted to
+	// keep the cache within its limits.
+	EventDelete
+	// EventExpire means an expired item was removed by DeleteExpired.
+	EventExpire
+)
+
+// Event is a change to a cache, delivered to subscribers. See Subscribe.
+type Event[K comparable, T any] struct {
+	Type  EventType
+	Key   K
+	Value T
+}
+
+// eventBufferSize is the capacity of each subscriber's channel.
+const eventBufferSize = 128
+
+// eventHub delivers events to a cache's subscribers.
+type eventHub[K comparable, T any] struct {
+	mu   sync.RWMutex
+	subs map[chan Event[K, T]]struct{}
+	// dropped points to the owning cache's counter
+	dropped *uint64
+}
+
+// publish sends ev to every subscriber without blocking; subscribers whose
+// channel is full miss the event.
+func (h *eventHub[K, T]) publish(ev Event[K, T]) {
+	h.mu.RLock()
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+			atomic.AddUint64(h.dropped, 1)
+		}
+	}
+	h.mu.RUnlock()
+}
+
+// publish sends ev to the cache's subscribers, if any. If the cache was
+// created with WithAsyncCallbacks, ev is queued on the dispatcher, which also
+// publishes the events of evicted items, so that subscribers receive all
+// events in order. c.mu must be held.
+func (c *cache[K, T]) publish(ev Event[K, T]) {
+	if c.events == nil {
+		return
+	}
+	h := c.events
+	if c.async == nil {
+		h.publish(ev)
+		return
+	}
+	c.async.enqueue(func() {
+		h.publish(ev)
+	})
+}
+
+// active reports whether there are any subscribers.
+func (h *eventHub[K, T]) active() bool {
+	if h == nil {
+		return false
+	}
+	h.mu.RLock()
+	n := len(h.subs)
+	h.mu.RUnlock()
+	return n > 0
+}
+
+// Subscribe returns a channel on which changes to the cache are delivered,
+// and a function that ends the subscription and closes the channel. Each
+// subscriber gets its own channel. Flush does not produce events.
+//
+// Events are sent without blocking, so a slow subscriber never slows down the
+// cache: the channel is buffered, and when its buffer is full, new events for
+// that subscriber are dropped (and counted in Stats().DroppedEvents) until it
+// catches up. Subscribers that can't tolerate gaps should re-read the cache
+// after noticing a drop.
+func (c *cache[K, T]) Subscribe() (<-chan Event[K, T], func()) {
+	ch := make(chan Event[K, T], eventBufferSize)
+	c.mu.Lock()
+	if c.events == nil {
+		c.events = &eventHub[K, T]{
+			subs:    make(map[chan Event[K, T]]struct{}),
+			dropped: &c.stats.droppedEvents,
+		}
+	}
+	h := c.events
+	c.mu.Unlock()
+
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, ch)
+			close(ch)
+			h.mu.Unlock()
+		})
+	}
+}
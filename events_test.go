@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribe(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	ch, unsubscribe := tc.Subscribe()
+	ch2, unsubscribe2 := tc.Subscribe()
+	defer unsubscribe2()
+
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Delete("a")
+	tc.Set("b", 2, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+	tc.DeleteExpired()
+
+	want := []Event[string, int]{
+		{EventSet, "a", 1},
+		{EventDelete, "a", 1},
+		{EventSet, "b", 2},
+		{EventExpire, "b", 2},
+	}
+	for _, c := range []<-chan Event[string, int]{ch, ch2} {
+		for _, ev := range want {
+			assert.Equal(t, ev, <-c)
+		}
+	}
+
+	unsubscribe()
+	unsubscribe()
+	_, ok := <-ch
+	assert.False(t, ok, "channel wasn't closed by unsubscribe")
+	tc.Set("c", 3, DefaultExpiration)
+	assert.Equal(t, Event[string, int]{EventSet, "c", 3}, <-ch2)
+}
+
+func TestSubscribeAsyncOrder(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0, WithAsyncCallbacks[string, int](10))
+	release := make(chan struct{})
+	tc.OnEvicted(func(k string, v int) {
+		<-release
+	})
+	ch, unsubscribe := tc.Subscribe()
+	defer unsubscribe()
+
+	tc.Set("k", 1, DefaultExpiration)
+	tc.Delete("k")
+	tc.Set("k", 2, DefaultExpiration)
+	close(release)
+
+	want := []Event[string, int]{
+		{EventSet, "k", 1},
+		{EventDelete, "k", 1},
+		{EventSet, "k", 2},
+	}
+	for _, ev := range want {
+		assert.Equal(t, ev, <-ch)
+	}
+}
+
+func TestSubscribeSlowSubscriber(t *testing.T) {
+	tc := New[int, int](DefaultExpiration, 0)
+	ch, unsubscribe := tc.Subscribe()
+	defer unsubscribe()
+	for i := 0; i < eventBufferSize+10; i++ {
+		tc.Set(i, i, DefaultExpiration)
+	}
+	assert.Equal(t, eventBufferSize, len(ch))
+	assert.Equal(t, uint64(10), tc.Stats().DroppedEvents)
+}
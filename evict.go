@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// EvictReason describes why an item was removed from a cache.
+type EvictReason int
+
+const (
+	// Deleted means the item was deleted manually, e.g. with Delete.
+	Deleted EvictReason = iota
+	// Expired means the item expired and was deleted by DeleteExpired.
+	Expired
+	// Replaced means the item was overwritten by a new value for its key.
+	Replaced
+	// CapacityEvicted means the item was evicted to keep the cache within
+	// the limits set by WithMaxItems or WithMaxBytes.
+	CapacityEvicted
+)
+
+// String returns the name of the reason.
+func (r EvictReason) String() string {
+	switch r {
+	case Deleted:
+		return "Deleted"
+	case Expired:
+		return "Expired"
+	case Replaced:
+		return "Replaced"
+	case CapacityEvicted:
+		return "CapacityEvicted"
+	}
+	return "EvictReason(" + strconv.Itoa(int(r)) + ")"
+}
+
+// OnEvictedReason sets an (optional) function that is called with the key,
+// value and reason whenever an item is evicted from the cache, including when
+// it is deleted manually, expires, is overwritten or is evicted to make room.
+// It is called in addition to any OnEvicted or OnExpired function. Set to nil
+// to disable.
+func (c *cache[K, T]) OnEvictedReason(f func(K, T, EvictReason)) {
+	c.mu.Lock()
+	c.onEvictedReason = f
+	c.mu.Unlock()
+}
+
+// evictionHooks is a copy of a cache's eviction callbacks, taken while
+// holding the cache's lock so that they can be called after releasing it.
+type evictionHooks[K comparable, T any] struct {
+	onEvicted       func(K, T)
+	onExpired       func(K, T)
+	onEvictedReason func(K, T, EvictReason)
+	events          *eventHub[K, T]
+	async           *dispatcher
+	observer        MetricsObserver[K]
+	onPanic         func(error)
+}
+
+// hooks returns the cache's current eviction callbacks. c.mu must be held.
+func (c *cache[K, T]) hooks() evictionHooks[K, T] {
+	return evictionHooks[K, T]{
+		onEvicted:       c.onEvicted,
+		onExpired:       c.onExpired,
+		onEvictedReason: c.onEvictedReason,
+		events:          c.events,
+		async:           c.async,
+		observer:        c.observer,
+		onPanic:         c.onPanic,
+	}
+}
+
+// isSet reports whether any callback or metrics observer is set, or anyone is
+// subscribed to events.
+func (h evictionHooks[K, T]) isSet() bool {
+	return h.onEvicted != nil || h.onExpired != nil || h.onEvictedReason != nil ||
+		h.observer != nil || h.events.active()
+}
+
+// fire reports an evicted item to the callbacks, on the dispatcher's
+// goroutine if the cache was created with WithAsyncCallbacks.
+func (h evictionHooks[K, T]) fire(k K, v T, reason EvictReason, cleanup func(T)) {
+	if h.async == nil {
+		h.call(k, v, reason, cleanup)
+		return
+	}
+	if !h.isSet() && cleanup == nil {
+		return
+	}
+	h.async.dispatch(func() {
+		h.call(k, v, reason, cleanup)
+	})
+}
+
+// call runs the callbacks for an evicted item. Expired items go to the
+// OnExpired function if one is set, and to the OnEvicted function otherwise.
+// The item's own cleanup function, if any, is called last.
+func (h evictionHooks[K, T]) call(k K, v T, reason EvictReason, cleanup func(T)) {
+	if reason == Expired && h.onExpired != nil {
+		h.guard(k, func() { h.onExpired(k, v) })
+	} else if h.onEvicted != nil {
+		h.guard(k, func() { h.onEvicted(k, v) })
+	}
+	if h.onEvictedReason != nil {
+		h.guard(k, func() { h.onEvictedReason(k, v, reason) })
+	}
+	if h.observer != nil {
+		h.guard(k, func() { h.observer.OnEviction(k, reason) })
+	}
+	if h.events != nil {
+		switch reason {
+		case Expired:
+			h.events.publish(Event[K, T]{EventExpire, k, v})
+		case Deleted, CapacityEvicted:
+			h.events.publish(Event[K, T]{EventDelete, k, v})
+		}
+	}
+	if cleanup != nil {
+		h.guard(k, func() { cleanup(v) })
+	}
+}
+
+// guard calls f, a callback for the item stored under k. If the cache was
+// created with WithRecoverCallbacks, a panic in f is recovered and reported to
+// the handler.
+func (h evictionHooks[K, T]) guard(k K, f func()) {
+	if h.onPanic == nil {
+		f()
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			h.onPanic(fmt.Errorf("eviction callback for %v panicked: %v", k, r))
+		}
+	}()
+	f()
+}
+
+// fireAll reports each of the evicted items to the callbacks.
+func (h evictionHooks[K, T]) fireAll(evicted []keyAndValue[K, T]) {
+	for _, v := range evicted {
+		h.fire(v.key, v.value, v.reason, v.cleanup)
+	}
+}
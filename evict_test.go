@@ -0,0 +1,210 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnEvictedReason(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0, WithMaxItems[string, int](2))
+	reasons := map[string]EvictReason{}
+	tc.OnEvictedReason(func(k string, v int, reason EvictReason) {
+		reasons[k] = reason
+	})
+	evicted := 0
+	tc.OnEvicted(func(k string, v int) {
+		evicted++
+	})
+
+	tc.Set("replaced", 1, DefaultExpiration)
+	tc.Set("replaced", 2, DefaultExpiration)
+	tc.Set("deleted", 1, DefaultExpiration)
+	tc.Delete("deleted")
+	tc.Set("expired", 1, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+	tc.DeleteExpired()
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 1, DefaultExpiration) // evicts replaced
+
+	assert.Equal(t, map[string]EvictReason{
+		"replaced": CapacityEvicted,
+		"deleted":  Deleted,
+		"expired":  Expired,
+	}, reasons)
+	assert.Equal(t, 4, evicted, "OnEvicted wasn't called alongside OnEvictedReason")
+}
+
+func TestOnEvictedReasonReplaced(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	var got []EvictReason
+	tc.OnEvictedReason(func(k string, v int, reason EvictReason) {
+		got = append(got, reason)
+	})
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Set("foo", 2, DefaultExpiration)
+	tc.SetMany(map[string]int{"foo": 3}, DefaultExpiration)
+	assert.Equal(t, []EvictReason{Replaced, Replaced}, got)
+}
+
+func TestOnEvictedOverwrite(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	var got []int
+	tc.OnEvicted(func(k string, v int) {
+		// Calling the cache would deadlock if the lock were still held
+		_, _ = tc.Get(k)
+		got = append(got, v)
+	})
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.Set("foo", 2, DefaultExpiration)
+	assert.NoError(t, tc.Replace("foo", 3, DefaultExpiration))
+	tc.Set("foo", 4, DefaultExpiration)
+	assert.Equal(t, []int{1, 3}, got)
+}
+
+func TestEvictReasonString(t *testing.T) {
+	assert.Equal(t, "Deleted", Deleted.String())
+	assert.Equal(t, "Expired", Expired.String())
+	assert.Equal(t, "Replaced", Replaced.String())
+	assert.Equal(t, "CapacityEvicted", CapacityEvicted.String())
+	assert.Equal(t, "EvictReason(42)", EvictReason(42).String())
+}
+
+func TestSetWithCleanup(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	tc := New[string, int](DefaultExpiration, 0,
+		WithClock[string, int](clock), WithMaxItems[string, int](3))
+	var order []string
+	cleaned := map[string]int{}
+	cleanup := func(k string) func(int) {
+		return func(v int) {
+			order = append(order, "cleanup "+k)
+			cleaned[k] = v
+		}
+	}
+	tc.OnEvicted(func(k string, v int) {
+		order = append(order, "evicted "+k)
+	})
+
+	tc.SetWithCleanup("deleted", 1, DefaultExpiration, cleanup("deleted"))
+	tc.Delete("deleted")
+	assert.Equal(t, []string{"evicted deleted", "cleanup deleted"}, order)
+
+	tc.SetWithCleanup("expired", 2, time.Minute, cleanup("expired"))
+	clock.Advance(2 * time.Minute)
+	tc.DeleteExpired()
+	assert.Equal(t, 2, cleaned["expired"])
+
+	tc.SetWithCleanup("replaced", 3, DefaultExpiration, cleanup("replaced"))
+	tc.Set("replaced", 4, DefaultExpiration)
+	assert.Equal(t, 3, cleaned["replaced"])
+	tc.Delete("replaced")
+	_, found := cleaned["replaced"]
+	assert.True(t, found)
+	assert.Equal(t, 3, cleaned["replaced"], "cleanup of the old value ran for the new one")
+
+	tc.SetWithCleanup("oldest", 5, DefaultExpiration, cleanup("oldest"))
+	tc.Set("b", 0, DefaultExpiration)
+	tc.Set("c", 0, DefaultExpiration)
+	tc.Set("d", 0, DefaultExpiration)
+	assert.Equal(t, 5, cleaned["oldest"], "cleanup didn't run on capacity eviction")
+
+	tc.SetWithCleanup("taken", 6, DefaultExpiration, cleanup("taken"))
+	v, _ := tc.GetAndDelete("taken")
+	assert.Equal(t, 6, v)
+	_, found = cleaned["taken"]
+	assert.False(t, found, "cleanup ran for a value returned by GetAndDelete")
+
+	tc.SetWithCleanup("flushed", 7, DefaultExpiration, cleanup("flushed"))
+	_, _ = Increment(tc, "flushed", 1)
+	tc.FlushWithEvict()
+	assert.Equal(t, 8, cleaned["flushed"])
+}
+
+func TestSetWithCleanupKept(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	cleaned := map[string]int{}
+	cleanup := func(k string) func(int) {
+		return func(v int) {
+			cleaned[k] = v
+		}
+	}
+	eq := func(a, b int) bool { return a == b }
+
+	tc.SetWithCleanup("replace", 1, DefaultExpiration, cleanup("replace"))
+	assert.NoError(t, tc.Replace("replace", 2, DefaultExpiration))
+	tc.Delete("replace")
+	assert.Equal(t, 2, cleaned["replace"], "Replace dropped the cleanup")
+
+	tc.SetWithCleanup("cas", 1, DefaultExpiration, cleanup("cas"))
+	assert.True(t, tc.CompareAndSwap("cas", 1, 2, DefaultExpiration, eq))
+	tc.Delete("cas")
+	assert.Equal(t, 2, cleaned["cas"], "CompareAndSwap dropped the cleanup")
+
+	tc.SetWithCleanup("version", 1, DefaultExpiration, cleanup("version"))
+	_, version, _ := tc.GetVersioned("version")
+	assert.True(t, tc.SetIfVersion("version", 2, DefaultExpiration, version))
+	tc.Delete("version")
+	assert.Equal(t, 2, cleaned["version"], "SetIfVersion dropped the cleanup")
+
+	tc.SetWithCleanup("merge", 1, DefaultExpiration, cleanup("merge"))
+	other := New[string, int](DefaultExpiration, 0)
+	other.Set("merge", 2, DefaultExpiration)
+	tc.Merge(other, nil)
+	tc.Delete("merge")
+	assert.Equal(t, 2, cleaned["merge"], "Merge dropped the cleanup")
+
+	tc.SetWithCleanup("load", 1, DefaultExpiration, cleanup("load"))
+	tc.load(map[string]Item[int]{"load": {Object: 2}}, func(existing, incoming Item[int]) Item[int] {
+		return incoming
+	})
+	tc.Delete("load")
+	assert.Equal(t, 2, cleaned["load"], "LoadMerge dropped the cleanup")
+
+	tc.SetWithCleanup("renamed", 1, DefaultExpiration, cleanup("renamed"))
+	assert.True(t, tc.Rename("renamed", "to"))
+	tc.Delete("to")
+	assert.Equal(t, 1, cleaned["renamed"], "Rename dropped the cleanup")
+
+	tc.SetWithCleanup("taken", 1, DefaultExpiration, cleanup("taken"))
+	tc.SetReturningOld("taken", 2, DefaultExpiration)
+	tc.Delete("taken")
+	_, found := cleaned["taken"]
+	assert.False(t, found, "cleanup ran for a value returned by SetReturningOld")
+
+	assert.Len(t, tc.cleanups, 0)
+	assert.True(t, Item[int]{Object: 1} == Item[int]{Object: 1})
+}
+
+func TestWithRecoverCallbacks(t *testing.T) {
+	clock := NewFakeClock(time.Date(2022, 6, 16, 0, 0, 0, 0, time.UTC))
+	var errs []error
+	tc := New[string, int](DefaultExpiration, 0,
+		WithClock[string, int](clock),
+		WithRecoverCallbacks[string, int](func(err error) {
+			errs = append(errs, err)
+		}))
+	tc.OnEvicted(func(k string, v int) {
+		panic("boom")
+	})
+	var reasons []EvictReason
+	tc.OnEvictedReason(func(k string, v int, reason EvictReason) {
+		reasons = append(reasons, reason)
+	})
+	cleaned := false
+	tc.SetWithCleanup("a", 1, DefaultExpiration, func(int) {
+		cleaned = true
+	})
+	tc.Set("b", 2, time.Second)
+	tc.Set("c", 3, time.Second)
+
+	assert.NotPanics(t, func() { tc.Delete("a") })
+	assert.True(t, cleaned, "cleanup wasn't called after a panic")
+	clock.Advance(2 * time.Second)
+	assert.NotPanics(t, tc.DeleteExpired)
+	assert.Equal(t, 0, tc.ItemCount())
+	assert.Len(t, errs, 3)
+	assert.Contains(t, errs[0].Error(), "boom")
+	assert.Equal(t, []EvictReason{Deleted, Expired, Expired}, reasons)
+}
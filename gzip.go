@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"compress/gzip"
+	"os"
+)
+
+// SaveFileGzip is like SaveFile, but compresses the saved items with gzip
+// using the given compression level, which is one of the levels accepted by
+// gzip.NewWriterLevel, e.g. gzip.BestSpeed, gzip.BestCompression or
+// gzip.DefaultCompression.
+func (c *cache[K, T]) SaveFileGzip(fname string, level int) error {
+	fp, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	zw, err := gzip.NewWriterLevel(fp, level)
+	if err != nil {
+		_ = fp.Close()
+		return err
+	}
+	err = c.Save(zw)
+	if err != nil {
+		_ = zw.Close()
+		_ = fp.Close()
+		return err
+	}
+	err = zw.Close()
+	if err != nil {
+		_ = fp.Close()
+		return err
+	}
+	return fp.Close()
+}
+
+// LoadFileGzip loads and adds cache items written by SaveFileGzip from the
+// given filename, excluding any items with keys that already exist in the
+// current cache.
+func (c *cache[K, T]) LoadFileGzip(fname string) error {
+	fp, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	zr, err := gzip.NewReader(fp)
+	if err != nil {
+		_ = fp.Close()
+		return err
+	}
+	err = c.Load(zr)
+	if err != nil {
+		_ = fp.Close()
+		return err
+	}
+	err = zr.Close()
+	if err != nil {
+		_ = fp.Close()
+		return err
+	}
+	return fp.Close()
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"compress/gzip"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGzipFileSerialization(t *testing.T) {
+	tc := New[int, string](DefaultExpiration, 0)
+	for i := 0; i < 100; i++ {
+		tc.Set(i, strings.Repeat("a", 100), DefaultExpiration)
+	}
+	f, err := os.CreateTemp("", "go-cache-cache.gob.gz")
+	if err != nil {
+		t.Fatal("Couldn't create cache file:", err)
+	}
+	fname := f.Name()
+	_ = f.Close()
+	defer os.Remove(fname)
+	assert.NoError(t, tc.SaveFileGzip(fname, gzip.BestCompression))
+
+	raw, err := os.CreateTemp("", "go-cache-cache.gob")
+	if err != nil {
+		t.Fatal("Couldn't create cache file:", err)
+	}
+	rawName := raw.Name()
+	_ = raw.Close()
+	defer os.Remove(rawName)
+	assert.NoError(t, tc.SaveFile(rawName))
+	zfi, _ := os.Stat(fname)
+	rfi, _ := os.Stat(rawName)
+	assert.Less(t, zfi.Size(), rfi.Size(), "compressed snapshot isn't smaller")
+
+	oc := New[int, string](DefaultExpiration, 0)
+	oc.Set(1, "b", DefaultExpiration) // this should not be overwritten
+	assert.NoError(t, oc.LoadFileGzip(fname))
+	assert.Equal(t, 100, oc.ItemCount())
+	b, _ := oc.Get(1)
+	assert.Equal(t, "b", b)
+	a, _ := oc.Get(2)
+	assert.Equal(t, strings.Repeat("a", 100), a)
+
+	assert.Error(t, oc.LoadFileGzip(rawName), "loaded an uncompressed file")
+	assert.Error(t, tc.SaveFileGzip(fname, 42), "accepted an invalid compression level")
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// heapWatcher evicts items from a cache created with WithHeapPressureEviction
+// whenever the heap grows beyond a threshold.
+type heapWatcher[K comparable, T any] struct {
+	threshold uint64
+	interval  time.Duration
+	// heapAlloc returns the number of bytes allocated on the heap. It is a
+	// field so that tests can replace it.
+	heapAlloc func() uint64
+	stopCh    chan struct{}
+	done      chan struct{}
+	stopOnce  sync.Once
+}
+
+func newHeapWatcher[K comparable, T any](threshold uint64, interval time.Duration) *heapWatcher[K, T] {
+	return &heapWatcher[K, T]{
+		threshold: threshold,
+		interval:  interval,
+		heapAlloc: readHeapAlloc,
+		stopCh:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// readHeapAlloc returns runtime.MemStats.HeapAlloc.
+func readHeapAlloc() uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.HeapAlloc
+}
+
+// run checks the heap every interval until stopped.
+func (h *heapWatcher[K, T]) run(c *cache[K, T]) {
+	defer close(h.done)
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.check(c)
+		case <-h.stopCh:
+			return
+		}
+	}
+}
+
+// stop stops the goroutine started by run, waiting for it to return if wait
+// is true. It may be called more than once.
+func (h *heapWatcher[K, T]) stop(wait bool) {
+	h.stopOnce.Do(func() {
+		close(h.stopCh)
+	})
+	if wait {
+		<-h.done
+	}
+}
+
+// check evicts the share of c's items by which the heap exceeds the
+// threshold, assuming that they take up the heap in proportion to their
+// number, and at least one item.
+func (h *heapWatcher[K, T]) check(c *cache[K, T]) {
+	alloc := h.heapAlloc()
+	if alloc <= h.threshold {
+		return
+	}
+	over := float64(alloc-h.threshold) / float64(alloc)
+	c.mu.Lock()
+	n := int(over * float64(len(c.items)))
+	if n < 1 {
+		n = 1
+	}
+	evicted := c.evictOldest(n)
+	hooks := c.hooks()
+	c.mu.Unlock()
+	atomic.AddUint64(&c.stats.evictions, uint64(len(evicted)))
+	hooks.fireAll(evicted)
+}
+
+// evictOldest removes up to n items and returns them. If the cache has an
+// eviction policy, the policy picks the items; otherwise the items that were
+// stored longest ago are removed. c.mu must be held.
+func (c *cache[K, T]) evictOldest(n int) []keyAndValue[K, T] {
+	var evicted []keyAndValue[K, T]
+	if c.policy != nil {
+		for len(evicted) < n {
+			k, ok := c.policy.Evict()
+			if !ok {
+				break
+			}
+			v, cleanup, _ := c.delete(k)
+			evicted = append(evicted, keyAndValue[K, T]{k, v.Object, CapacityEvicted, cleanup})
+		}
+		return evicted
+	}
+	keys := make([]K, 0, len(c.items))
+	for k := range c.items {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.items[keys[i]].version < c.items[keys[j]].version
+	})
+	if n < len(keys) {
+		keys = keys[:n]
+	}
+	for _, k := range keys {
+		v, cleanup, _ := c.delete(k)
+		evicted = append(evicted, keyAndValue[K, T]{k, v.Object, CapacityEvicted, cleanup})
+	}
+	return evicted
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeapWatcherCheck(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	for i := 0; i < 10; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	var reasons []EvictReason
+	tc.OnEvictedReason(func(k string, v int, reason EvictReason) {
+		reasons = append(reasons, reason)
+	})
+	h := newHeapWatcher[string, int](1000, time.Hour)
+	alloc := uint64(1000)
+	h.heapAlloc = func() uint64 { return alloc }
+
+	h.check(tc.cache)
+	assert.Equal(t, 10, tc.ItemCount())
+
+	// 20% over the threshold evicts the two oldest items
+	alloc = 1250
+	h.check(tc.cache)
+	assert.Equal(t, 8, tc.ItemCount())
+	assert.False(t, tc.Contains("0"))
+	assert.False(t, tc.Contains("1"))
+	assert.True(t, tc.Contains("2"))
+	assert.Equal(t, []EvictReason{CapacityEvicted, CapacityEvicted}, reasons)
+	assert.Equal(t, uint64(2), tc.Stats().Evictions)
+
+	// At least one item is evicted
+	alloc = 1001
+	h.check(tc.cache)
+	assert.Equal(t, 7, tc.ItemCount())
+	assert.False(t, tc.Contains("2"))
+}
+
+func TestHeapWatcherCheckPolicy(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0, WithMaxItems[string, int](100))
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, DefaultExpiration)
+	tc.Get("a")
+	h := newHeapWatcher[string, int](1, time.Hour)
+	h.heapAlloc = func() uint64 { return 2 }
+	h.check(tc.cache)
+	assert.False(t, tc.Contains("b"))
+	assert.True(t, tc.Contains("a"))
+}
+
+func TestWithHeapPressureEviction(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0, WithHeapPressureEviction[string, int](1, time.Millisecond))
+	assert.True(t, tc.hasWorkers())
+	tc.Set("a", 1, DefaultExpiration)
+	assert.Eventually(t, func() bool {
+		return tc.ItemCount() == 0
+	}, time.Second, time.Millisecond)
+	tc.Close()
+	assert.False(t, tc.hasWorkers())
+
+	assert.Nil(t, New[string, int](DefaultExpiration, 0, WithHeapPressureEviction[string, int](0, time.Second)).heap)
+}
@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// jsonItem is the JSON representation of an Item. The expiration is encoded
+// as an RFC 3339 timestamp with nanosecond precision in UTC (the format of
+// time.Time's MarshalJSON), and omitted for items that never expire.
+type jsonItem[T any] struct {
+	Object     T          `json:"object"`
+	Expiration *time.Time `json:"expiration,omitempty"`
+}
+
+// SaveJSON writes the cache's unexpired items as a JSON object to an
+// io.Writer. Each key maps to an object holding the item's value under
+// "object" and, unless the item never expires, its expiration time under
+// "expiration" as an RFC 3339 timestamp with nanosecond precision, e.g.
+//
+//	{"foo":{"object":"bar","expiration":"2022-06-16T10:00:00.123456789Z"}}
+//
+// JSON object keys must be strings, so keys are encoded as follows: keys of a
+// string type are used as they are, keys implementing encoding.TextMarshaler
+// are encoded with MarshalText, keys implementing encoding.BinaryMarshaler
+// (but not TextMarshaler) are encoded with MarshalBinary and then as base64,
+// and keys of an integer type are formatted in base 10. To be loaded again,
+// the key type (or a pointer to it) must implement the matching
+// encoding.TextUnmarshaler or encoding.BinaryUnmarshaler. SaveJSON returns an
+// error for any other key type.
+func (c *cache[K, T]) SaveJSON(w io.Writer) error {
+	items := c.Items()
+	m := make(map[string]jsonItem[T], len(items))
+	for k, v := range items {
+		key, err := marshalJSONKey(k)
+		if err != nil {
+			return err
+		}
+		ji := jsonItem[T]{Object: v.Object}
+		if v.Expiration > 0 {
+			e := time.Unix(0, v.Expiration).UTC()
+			ji.Expiration = &e
+		}
+		m[key] = ji
+	}
+	return json.NewEncoder(w).Encode(m)
+}
+
+// SaveJSONFile saves the cache's items as JSON to the given filename, creating
+// the file if it doesn't exist, and overwriting it if it does.
+func (c *cache[K, T]) SaveJSONFile(fname string) error {
+	fp, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	err = c.SaveJSON(fp)
+	if err != nil {
+		_ = fp.Close()
+		return err
+	}
+	return fp.Close()
+}
+
+// LoadJSON adds cache items written by SaveJSON from an io.Reader, excluding
+// any items with keys that already exist (and haven't expired) in the current
+// cache.
+func (c *cache[K, T]) LoadJSON(r io.Reader) error {
+	m := map[string]jsonItem[T]{}
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return err
+	}
+	items := make(map[K]Item[T], len(m))
+	for key, v := range m {
+		k, err := unmarshalJSONKey[K](key)
+		if err != nil {
+			return err
+		}
+		item := Item[T]{Object: v.Object}
+		if v.Expiration != nil {
+			item.Expiration = v.Expiration.UnixNano()
+		}
+		items[k] = item
+	}
+	c.load(items, nil)
+	return nil
+}
+
+// LoadJSONFile loads and adds cache items written by SaveJSONFile from the
+// given filename, excluding any items with keys that already exist in the
+// current cache.
+func (c *cache[K, T]) LoadJSONFile(fname string) error {
+	fp, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	err = c.LoadJSON(fp)
+	if err != nil {
+		_ = fp.Close()
+		return err
+	}
+	return fp.Close()
+}
+
+// marshalJSONKey encodes k as a JSON object key. See SaveJSON.
+func marshalJSONKey[K comparable](k K) (string, error) {
+	rv := reflect.ValueOf(&k).Elem()
+	if rv.Kind() == reflect.String {
+		return rv.String(), nil
+	}
+	var m any = k
+	if _, ok := m.(encoding.TextMarshaler); !ok {
+		if _, ok := m.(encoding.BinaryMarshaler); !ok {
+			// The methods may have pointer receivers
+			m = &k
+		}
+	}
+	switch m := m.(type) {
+	case encoding.TextMarshaler:
+		b, err := m.MarshalText()
+		if err != nil {
+			return "", fmt.Errorf("encoding key %v: %w", k, err)
+		}
+		return string(b), nil
+	case encoding.BinaryMarshaler:
+		b, err := m.MarshalBinary()
+		if err != nil {
+			return "", fmt.Errorf("encoding key %v: %w", k, err)
+		}
+		return base64.StdEncoding.EncodeToString(b), nil
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("key type %T can't be used as a JSON object key", k)
+}
+
+// unmarshalJSONKey decodes a JSON object key written by marshalJSONKey.
+func unmarshalJSONKey[K comparable](s string) (K, error) {
+	var k K
+	rv := reflect.ValueOf(&k).Elem()
+	if rv.Kind() == reflect.String {
+		rv.SetString(s)
+		return k, nil
+	}
+	switch u := any(&k).(type) {
+	case encoding.TextUnmarshaler:
+		if err := u.UnmarshalText([]byte(s)); err != nil {
+			return k, fmt.Errorf("decoding key %q: %w", s, err)
+		}
+		return k, nil
+	case encoding.BinaryUnmarshaler:
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err == nil {
+			err = u.UnmarshalBinary(b)
+		}
+		if err != nil {
+			return k, fmt.Errorf("decoding key %q: %w", s, err)
+		}
+		return k, nil
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, rv.Type().Bits())
+		if err != nil {
+			return k, fmt.Errorf("decoding key %q: %w", s, err)
+		}
+		rv.SetInt(n)
+		return k, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(s, 10, rv.Type().Bits())
+		if err != nil {
+			return k, fmt.Errorf("decoding key %q: %w", s, err)
+		}
+		rv.SetUint(n)
+		return k, nil
+	}
+	return k, fmt.Errorf("key type %T can't be used as a JSON object key", k)
+}
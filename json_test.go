@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONSerialization(t *testing.T) {
+	tc := New[string, TestStruct](DefaultExpiration, 0)
+	tc.Set("forever", TestStruct{Num: 1}, NoExpiration)
+	tc.Set("later", TestStruct{Num: 2, Children: []*TestStruct{{Num: 3}}}, time.Hour)
+	tc.Set("expired", TestStruct{Num: 4}, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+
+	fp := &bytes.Buffer{}
+	err := tc.SaveJSON(fp)
+	assert.NoError(t, err)
+
+	oc := New[string, TestStruct](DefaultExpiration, 0)
+	err = oc.LoadJSON(fp)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, oc.ItemCount())
+	x, exp, found := oc.GetWithExpiration("forever")
+	assert.True(t, found)
+	assert.Equal(t, 1, x.Num)
+	assert.True(t, exp.IsZero())
+
+	x, exp, found = oc.GetWithExpiration("later")
+	assert.True(t, found)
+	assert.Equal(t, 2, x.Num)
+	assert.Equal(t, 3, x.Children[0].Num)
+	assert.Equal(t, tc.items["later"].Expiration, exp.UnixNano())
+}
+
+func TestJSONFileSerialization(t *testing.T) {
+	tc := New[int, string](DefaultExpiration, 0)
+	tc.Set(1, "a", DefaultExpiration)
+	tc.Set(2, "b", DefaultExpiration)
+	f, err := os.CreateTemp("", "go-cache-cache.json")
+	if err != nil {
+		t.Fatal("Couldn't create cache file:", err)
+	}
+	fname := f.Name()
+	_ = f.Close()
+	defer os.Remove(fname)
+	assert.NoError(t, tc.SaveJSONFile(fname))
+
+	oc := New[int, string](DefaultExpiration, 0)
+	oc.Set(1, "aa", DefaultExpiration) // this should not be overwritten
+	assert.NoError(t, oc.LoadJSONFile(fname))
+	a, _ := oc.Get(1)
+	assert.Equal(t, "aa", a)
+	b, _ := oc.Get(2)
+	assert.Equal(t, "b", b)
+}
+
+type binaryKey struct {
+	A int32
+	B string
+}
+
+func (k binaryKey) MarshalBinary() ([]byte, error) {
+	return append([]byte{byte(k.A >> 24), byte(k.A >> 16), byte(k.A >> 8), byte(k.A)}, k.B...), nil
+}
+
+func (k *binaryKey) UnmarshalBinary(b []byte) error {
+	if len(b) < 4 {
+		return errors.New("short key")
+	}
+	k.A = int32(b[0])<<24 | int32(b[1])<<16 | int32(b[2])<<8 | int32(b[3])
+	k.B = string(b[4:])
+	return nil
+}
+
+type textKey struct {
+	X, Y int
+}
+
+func (k textKey) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d,%d", k.X, k.Y)), nil
+}
+
+func (k *textKey) UnmarshalText(b []byte) error {
+	_, err := fmt.Sscanf(string(b), "%d,%d", &k.X, &k.Y)
+	return err
+}
+
+func TestJSONBinaryMarshalerKeys(t *testing.T) {
+	tc := New[binaryKey, string](DefaultExpiration, 0)
+	tc.Set(binaryKey{1, "a"}, "one", DefaultExpiration)
+	tc.Set(binaryKey{-2, "b"}, "two", DefaultExpiration)
+	fp := &bytes.Buffer{}
+	assert.NoError(t, tc.SaveJSON(fp))
+
+	oc := New[binaryKey, string](DefaultExpiration, 0)
+	assert.NoError(t, oc.LoadJSON(fp))
+	assert.Equal(t, 2, oc.ItemCount())
+	x, _ := oc.Get(binaryKey{1, "a"})
+	assert.Equal(t, "one", x)
+	x, _ = oc.Get(binaryKey{-2, "b"})
+	assert.Equal(t, "two", x)
+}
+
+func TestJSONTextMarshalerKeys(t *testing.T) {
+	tc := New[textKey, int](DefaultExpiration, 0)
+	tc.Set(textKey{1, 2}, 3, DefaultExpiration)
+	fp := &bytes.Buffer{}
+	assert.NoError(t, tc.SaveJSON(fp))
+	assert.Contains(t, fp.String(), `"1,2"`)
+
+	oc := New[textKey, int](DefaultExpiration, 0)
+	assert.NoError(t, oc.LoadJSON(fp))
+	x, found := oc.Get(textKey{1, 2})
+	assert.True(t, found)
+	assert.Equal(t, 3, x)
+}
+
+func TestJSONIntegerKeys(t *testing.T) {
+	tc := New[int8, int](DefaultExpiration, 0)
+	tc.Set(-128, 1, DefaultExpiration)
+	fp := &bytes.Buffer{}
+	assert.NoError(t, tc.SaveJSON(fp))
+	assert.Contains(t, fp.String(), `"-128"`)
+
+	oc := New[int8, int](DefaultExpiration, 0)
+	assert.NoError(t, oc.LoadJSON(fp))
+	x, _ := oc.Get(-128)
+	assert.Equal(t, 1, x)
+
+	uc := New[uint8, int](DefaultExpiration, 0)
+	assert.Error(t, uc.LoadJSON(bytes.NewBufferString(`{"-1":{"object":1}}`)))
+}
+
+func TestJSONUnsupportedKeys(t *testing.T) {
+	type point struct {
+		X, Y int
+	}
+	tc := New[point, int](DefaultExpiration, 0)
+	tc.Set(point{1, 2}, 1, DefaultExpiration)
+	err := tc.SaveJSON(&bytes.Buffer{})
+	assert.ErrorContains(t, err, "can't be used as a JSON object key")
+}
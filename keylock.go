@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"sort"
+	"sync"
+)
+
+// keyLockStripes is the number of mutexes LockKey spreads the keys across.
+const keyLockStripes = 256
+
+// keyLocks are the striped mutexes behind LockKey.
+type keyLocks[K comparable] struct {
+	hasher func(K) uint64
+	mus    [keyLockStripes]sync.Mutex
+}
+
+// stripe returns the index of the mutex for k.
+func (l *keyLocks[K]) stripe(k K) int {
+	return int(l.hasher(k) % keyLockStripes)
+}
+
+// locks returns the cache's key locks, creating them on first use.
+func (c *cache[K, T]) locks() *keyLocks[K] {
+	c.keyLocksOnce.Do(func() {
+		c.keyLocks = &keyLocks[K]{hasher: NewHasher[K]()}
+	})
+	return c.keyLocks
+}
+
+// LockKey locks k for the caller and returns a function that unlocks it, so
+// that compound operations on k spanning several calls, such as a Get
+// followed by a Set of a modified value, can be made atomic with respect to
+// other callers of LockKey for k. The lock is advisory: it doesn't lock the
+// cache, whose methods can still be used by everyone, including for k, while
+// the key is locked. The returned function must be called exactly once.
+//
+// Keys are spread across a fixed number of mutexes, so different keys may
+// share one, and LockKey may wait for a caller holding the lock on another
+// key. In particular, a goroutine that already holds the lock on one key must
+// not call LockKey for another, or it may deadlock, even if all goroutines
+// lock keys in the same order; use LockKeys to lock several keys at once.
+func (c *cache[K, T]) LockKey(k K) (unlock func()) {
+	l := c.locks()
+	mu := &l.mus[l.stripe(k)]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// LockKeys is like LockKey, but locks all of the given keys at once, without
+// risking a deadlock with other callers of LockKey or LockKeys. It must not be
+// called by a goroutine that already holds the lock on a key.
+func (c *cache[K, T]) LockKeys(keys ...K) (unlock func()) {
+	l := c.locks()
+	stripes := make([]int, 0, len(keys))
+	seen := make(map[int]bool, len(keys))
+	for _, k := range keys {
+		if i := l.stripe(k); !seen[i] {
+			seen[i] = true
+			stripes = append(stripes, i)
+		}
+	}
+	// Locking the mutexes in a fixed order avoids deadlocks between
+	// callers locking overlapping sets of keys
+	sort.Ints(stripes)
+	for _, i := range stripes {
+		l.mus[i].Lock()
+	}
+	return func() {
+		for _, i := range stripes {
+			l.mus[i].Unlock()
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockKey(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("a", 0, DefaultExpiration)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := tc.LockKey("a")
+			defer unlock()
+			v, _ := tc.Get("a")
+			tc.Set("a", v+1, DefaultExpiration)
+		}()
+	}
+	wg.Wait()
+	v, _ := tc.Get("a")
+	assert.Equal(t, 50, v)
+}
+
+func TestLockKeys(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	keys := make([]string, 20)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		tc.Set(keys[i], 100, DefaultExpiration)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			from, to := keys[i%len(keys)], keys[(i*7+3)%len(keys)]
+			unlock := tc.LockKeys(from, to, from)
+			defer unlock()
+			a, _ := tc.Get(from)
+			tc.Set(from, a-1, DefaultExpiration)
+			b, _ := tc.Get(to)
+			tc.Set(to, b+1, DefaultExpiration)
+		}(i)
+	}
+	wg.Wait()
+	total := 0
+	for _, k := range keys {
+		v, _ := tc.Get(k)
+		total += v
+	}
+	assert.Equal(t, 100*len(keys), total)
+}
@@ -0,0 +1,134 @@
+package cache
+
+import "container/list"
+
+// lfu is the EvictionPolicy that evicts the least frequently used item. Keys
+// are kept in one list per use count, ordered by recency of use, so that both
+// recording a use and finding the item to evict take O(1) time.
+type lfu[K comparable] struct {
+	elems map[K]*list.Element
+	// freqs holds a list of *lfuEntry for every use count that some key has.
+	freqs map[int]*list.List
+	// minFreq is the smallest use count in freqs, or 0 if it must be
+	// recomputed.
+	minFreq int
+	// newest is the key last passed to RecordInsert, if no key has been
+	// accessed since, which Evict passes over while other keys are tracked.
+	newest    K
+	hasNewest bool
+}
+
+type lfuEntry[K comparable] struct {
+	key  K
+	freq int
+}
+
+// NewLFUPolicy returns an EvictionPolicy that evicts the least frequently used
+// item, where storing or reading an item counts as using it. Among items that
+// were used equally often, the least recently used one is evicted. The item
+// stored last isn't evicted while there are others, until another item is
+// read, so that a new item, which has been used only once, isn't evicted by
+// the very call that stored it.
+func NewLFUPolicy[K comparable]() EvictionPolicy[K] {
+	return &lfu[K]{
+		elems: make(map[K]*list.Element),
+		freqs: make(map[int]*list.List),
+	}
+}
+
+// RecordInsert adds k with a use count of one, or counts a use of k if it is
+// already tracked.
+func (l *lfu[K]) RecordInsert(k K) {
+	if _, ok := l.elems[k]; ok {
+		l.RecordAccess(k)
+	} else {
+		l.push(&lfuEntry[K]{k, 1})
+		l.minFreq = 1
+	}
+	l.newest, l.hasNewest = k, true
+}
+
+// RecordAccess counts a use of k. It does nothing if k isn't tracked.
+func (l *lfu[K]) RecordAccess(k K) {
+	l.newest, l.hasNewest = *new(K), false
+	e, ok := l.elems[k]
+	if !ok {
+		return
+	}
+	entry := l.unlink(e)
+	if l.minFreq == entry.freq && l.freqs[entry.freq] == nil {
+		l.minFreq++
+	}
+	entry.freq++
+	l.push(entry)
+}
+
+// Remove forgets k. It does nothing if k isn't tracked.
+func (l *lfu[K]) Remove(k K) {
+	e, ok := l.elems[k]
+	if !ok {
+		return
+	}
+	entry := l.unlink(e)
+	delete(l.elems, k)
+	if l.hasNewest && l.newest == k {
+		l.newest, l.hasNewest = *new(K), false
+	}
+	if l.minFreq == entry.freq && l.freqs[entry.freq] == nil {
+		l.minFreq = 0
+	}
+}
+
+// Evict returns the least recently used of the least frequently used keys,
+// passing over the newest key unless it is the only one, and false if there
+// are none.
+func (l *lfu[K]) Evict() (K, bool) {
+	if len(l.elems) == 0 {
+		return *new(K), false
+	}
+	if l.minFreq == 0 {
+		for f := range l.freqs {
+			if l.minFreq == 0 || f < l.minFreq {
+				l.minFreq = f
+			}
+		}
+	}
+	e := l.freqs[l.minFreq].Back()
+	if k := e.Value.(*lfuEntry[K]).key; !l.hasNewest || k != l.newest || len(l.elems) == 1 {
+		return k, true
+	}
+	if prev := e.Prev(); prev != nil {
+		return prev.Value.(*lfuEntry[K]).key, true
+	}
+	// The newest key is alone with the smallest use count, so evict from the
+	// next smallest one
+	next := 0
+	for f := range l.freqs {
+		if f > l.minFreq && (next == 0 || f < next) {
+			next = f
+		}
+	}
+	return l.freqs[next].Back().Value.(*lfuEntry[K]).key, true
+}
+
+// push adds entry to the front of the list for its use count.
+func (l *lfu[K]) push(entry *lfuEntry[K]) {
+	ll := l.freqs[entry.freq]
+	if ll == nil {
+		ll = list.New()
+		l.freqs[entry.freq] = ll
+	}
+	l.elems[entry.key] = ll.PushFront(entry)
+}
+
+// unlink removes e from the list for its use count, dropping the list if it
+// becomes empty, and returns its entry.
+func (l *lfu[K]) unlink(e *list.Element) *lfuEntry[K] {
+	entry := e.Value.(*lfuEntry[K])
+	ll := l.freqs[entry.freq]
+	ll.Remove(e)
+	if ll.Len() == 0 {
+		delete(l.freqs, entry.freq)
+	}
+	return entry
+}
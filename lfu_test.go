@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLFUPolicy(t *testing.T) {
+	p := NewLFUPolicy[string]()
+	_, ok := p.Evict()
+	assert.False(t, ok)
+
+	p.RecordInsert("a")
+	p.RecordInsert("b")
+	p.RecordInsert("c")
+	p.RecordAccess("a")
+	p.RecordAccess("a")
+	p.RecordAccess("c")
+	// a: 3, c: 2, b: 1
+	k, ok := p.Evict()
+	assert.True(t, ok)
+	assert.Equal(t, "b", k)
+	p.Remove("b")
+	k, _ = p.Evict()
+	assert.Equal(t, "c", k)
+
+	// Ties are broken by recency of use
+	p.RecordAccess("c")
+	p.RecordInsert("d")
+	p.RecordAccess("d")
+	p.RecordAccess("d")
+	// a: 3, c: 3, d: 3
+	k, _ = p.Evict()
+	assert.Equal(t, "a", k)
+
+	p.Remove("a")
+	p.Remove("c")
+	p.Remove("missing")
+	k, _ = p.Evict()
+	assert.Equal(t, "d", k)
+	p.Remove("d")
+	_, ok = p.Evict()
+	assert.False(t, ok)
+}
+
+func TestWithEvictionPolicyLFU(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0,
+		WithMaxItems[string, int](3),
+		WithEvictionPolicy[string, int](NewLFUPolicy[string]))
+	var evicted []string
+	tc.OnEvicted(func(k string, v int) {
+		evicted = append(evicted, k)
+	})
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, DefaultExpiration)
+	tc.Get("a")
+	tc.Get("a")
+	tc.Get("c")
+	tc.Get("c")
+	tc.Get("c")
+	// LRU would evict a
+	tc.Set("d", 4, DefaultExpiration)
+	assert.Equal(t, []string{"b"}, evicted)
+	assert.ElementsMatch(t, []string{"a", "c", "d"}, tc.Keys())
+
+	tc.Flush()
+	tc.Set("e", 5, DefaultExpiration)
+	tc.Set("f", 6, DefaultExpiration)
+	tc.Get("e")
+	tc.Set("g", 7, DefaultExpiration)
+	tc.Set("h", 8, DefaultExpiration)
+	assert.Equal(t, []string{"b", "f"}, evicted)
+}
+
+func TestWithEvictionPolicyLFUAdmitsNewKeys(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0,
+		WithMaxItems[string, int](2),
+		WithEvictionPolicy[string, int](NewLFUPolicy[string]))
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Get("a")
+	tc.Get("b")
+	tc.Get("b")
+	tc.Set("c", 3, DefaultExpiration)
+	v, found := tc.Get("c")
+	assert.True(t, found, "new key was evicted by its own Set")
+	assert.Equal(t, 3, v)
+	assert.ElementsMatch(t, []string{"b", "c"}, tc.Keys())
+
+	// The newest key is passed over even if it's alone with the smallest
+	// use count
+	tc.Set("d", 4, DefaultExpiration)
+	assert.ElementsMatch(t, []string{"b", "d"}, tc.Keys())
+}
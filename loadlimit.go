@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// loadLimiter bounds the number of concurrent calls to the loader set with
+// WithLoader, see WithLoaderConcurrency.
+type loadLimiter struct {
+	// queued is first so that it is aligned for atomic access on 32-bit
+	// platforms.
+	queued int64
+	slots  chan struct{}
+}
+
+func newLoadLimiter(n int) *loadLimiter {
+	return &loadLimiter{slots: make(chan struct{}, n)}
+}
+
+// acquire waits for a free slot, or until ctx is done, in which case it
+// returns ctx.Err().
+func (l *loadLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	atomic.AddInt64(&l.queued, 1)
+	defer atomic.AddInt64(&l.queued, -1)
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees the slot taken by acquire.
+func (l *loadLimiter) release() {
+	<-l.slots
+}
+
+// loaderQueue returns the number of loads running and waiting for a slot, or
+// zeros if the cache wasn't created with WithLoaderConcurrency.
+func (c *cache[K, T]) loaderQueue() (running, queued int) {
+	if c.loadLimit == nil {
+		return 0, 0
+	}
+	return len(c.loadLimit.slots), int(atomic.LoadInt64(&c.loadLimit.queued))
+}
+
+// callLoader calls the loader for k, waiting for a free slot first if the
+// cache was created with WithLoaderConcurrency.
+func (c *cache[K, T]) callLoader(ctx context.Context, k K) (T, time.Duration, error) {
+	if c.loadLimit != nil {
+		if err := c.loadLimit.acquire(ctx); err != nil {
+			return *new(T), 0, err
+		}
+		defer c.loadLimit.release()
+	}
+	return c.loader(k)
+}
@@ -0,0 +1,82 @@
+package cache
+
+import "container/list"
+
+// EvictionPolicy decides which item a cache whose size is limited with
+// WithMaxItems or WithMaxBytes evicts when it grows beyond its limit. The
+// cache calls its methods while holding its write lock, so they don't need to
+// be safe for concurrent use, and must not call methods on the cache.
+type EvictionPolicy[K comparable] interface {
+	// RecordInsert is called when an item is stored under k, both for new
+	// keys and for keys whose item is overwritten.
+	RecordInsert(k K)
+	// RecordAccess is called when the item stored under k is read, e.g. by
+	// Get.
+	RecordAccess(k K)
+	// Remove is called when the item stored under k is removed from the
+	// cache for any reason, including when it was chosen by Evict. It must
+	// do nothing if k isn't tracked.
+	Remove(k K)
+	// Evict returns the key of the item to evict next, and false if no keys
+	// are tracked. It must not forget the key; Remove is called for it once
+	// the item has been deleted.
+	Evict() (K, bool)
+}
+
+// lru is the EvictionPolicy that evicts the least recently used item. It
+// tracks how recently each key was used, so that the least recently used
+// item can be found in O(1).
+type lru[K comparable] struct {
+	ll    *list.List
+	elems map[K]*list.Element
+}
+
+// NewLRUPolicy returns an EvictionPolicy that evicts the least recently used
+// item, where storing or reading an item counts as using it. This is the
+// policy used by default.
+func NewLRUPolicy[K comparable]() EvictionPolicy[K] {
+	return newLRU[K](0)
+}
+
+// newLRU returns an empty lru with room for n keys.
+func newLRU[K comparable](n int) *lru[K] {
+	return &lru[K]{
+		ll:    list.New(),
+		elems: make(map[K]*list.Element, n),
+	}
+}
+
+// RecordInsert marks k as the most recently used key, adding it if necessary.
+func (l *lru[K]) RecordInsert(k K) {
+	l.touch(k)
+}
+
+// RecordAccess marks k as the most recently used key.
+func (l *lru[K]) RecordAccess(k K) {
+	l.touch(k)
+}
+
+func (l *lru[K]) touch(k K) {
+	if e, ok := l.elems[k]; ok {
+		l.ll.MoveToFront(e)
+		return
+	}
+	l.elems[k] = l.ll.PushFront(k)
+}
+
+// Remove forgets k. It does nothing if k isn't tracked.
+func (l *lru[K]) Remove(k K) {
+	if e, ok := l.elems[k]; ok {
+		l.ll.Remove(e)
+		delete(l.elems, k)
+	}
+}
+
+// Evict returns the least recently used key, and false if there are none.
+func (l *lru[K]) Evict() (K, bool) {
+	e := l.ll.Back()
+	if e == nil {
+		return *new(K), false
+	}
+	return e.Value.(K), true
+}
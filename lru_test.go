@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxItems(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0, WithMaxItems[string, int](3))
+	var evicted []string
+	tc.OnEvicted(func(k string, v int) {
+		evicted = append(evicted, k)
+	})
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, DefaultExpiration)
+	tc.Get("a") // b is now the least recently used item
+	tc.Set("d", 4, DefaultExpiration)
+
+	assert.Equal(t, []string{"b"}, evicted)
+	assert.Equal(t, 3, tc.ItemCount())
+	_, found := tc.Get("b")
+	assert.False(t, found, "b was not evicted")
+
+	assert.NoError(t, tc.Add("e", 5, DefaultExpiration))
+	assert.Equal(t, []string{"b", "c"}, evicted)
+	assert.ElementsMatch(t, []string{"a", "d", "e"}, tc.Keys())
+	assert.Equal(t, uint64(2), tc.Stats().Evictions)
+}
+
+func TestMaxItemsDelete(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0, WithMaxItems[string, int](2))
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Delete("a")
+	tc.Set("c", 3, DefaultExpiration)
+	assert.ElementsMatch(t, []string{"b", "c"}, tc.Keys())
+	assert.Equal(t, 2, tc.policy.(*lru[string]).ll.Len())
+
+	tc.Flush()
+	assert.Equal(t, 0, tc.policy.(*lru[string]).ll.Len())
+}
+
+func TestMaxItemsWithJanitor(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, time.Millisecond, WithMaxItems[string, int](10))
+	defer tc.Close()
+	for i := 0; i < 20; i++ {
+		tc.Set(strconv.Itoa(i), i, 5*time.Millisecond)
+	}
+	assert.Equal(t, 10, tc.ItemCount())
+	<-time.After(20 * time.Millisecond)
+	assert.Equal(t, 0, tc.ItemCount())
+	tc.mu.RLock()
+	assert.Equal(t, 0, tc.policy.(*lru[string]).ll.Len())
+	tc.mu.RUnlock()
+}
+
+func TestNewFromMaxItems(t *testing.T) {
+	m := map[string]Item[int]{
+		"a": {Object: 1},
+		"b": {Object: 2},
+		"c": {Object: 3},
+	}
+	tc := NewFrom(DefaultExpiration, 0, m, WithMaxItems[string, int](2))
+	assert.Equal(t, 2, tc.ItemCount())
+	assert.Equal(t, 2, tc.policy.(*lru[string]).ll.Len())
+}
+
+func TestMaxBytes(t *testing.T) {
+	sizer := func(k string, v string) int64 {
+		return int64(len(k) + len(v))
+	}
+	tc := New[string, string](DefaultExpiration, 0, WithMaxBytes[string, string](10, sizer))
+	var evicted []string
+	tc.OnEvicted(func(k string, v string) {
+		evicted = append(evicted, k)
+	})
+	tc.Set("a", "1234", DefaultExpiration) // 5 bytes
+	tc.Set("b", "12", DefaultExpiration)   // 3 bytes
+	assert.Equal(t, int64(8), tc.size)
+	tc.Get("a")
+	tc.Set("c", "1", DefaultExpiration) // 2 bytes, fits exactly
+	assert.Empty(t, evicted)
+	tc.Set("d", "1", DefaultExpiration) // b is the least recently used
+	assert.Equal(t, []string{"b"}, evicted)
+	assert.Equal(t, int64(9), tc.size)
+
+	// Growing an existing item evicts too
+	tc.Set("d", "123", DefaultExpiration)
+	assert.Equal(t, []string{"b", "d", "a"}, evicted[:3])
+	assert.LessOrEqual(t, tc.size, int64(10))
+
+	tc.Delete("c")
+	tc.Flush()
+	assert.Equal(t, int64(0), tc.size)
+}
+
+func TestMaxBytesReplace(t *testing.T) {
+	sizer := func(k string, v string) int64 {
+		return int64(len(v))
+	}
+	tc := New[string, string](DefaultExpiration, 0, WithMaxBytes[string, string](10, sizer))
+	var evicted []string
+	tc.OnEvicted(func(k string, v string) {
+		evicted = append(evicted, k)
+	})
+	tc.Set("a", "xxxx", DefaultExpiration)
+	tc.Set("b", "yyyy", DefaultExpiration)
+	assert.NoError(t, tc.Replace("a", "zzzzzzzzzz", DefaultExpiration))
+	assert.Equal(t, []string{"b"}, evicted)
+	assert.Equal(t, []string{"a"}, tc.Keys())
+	assert.Equal(t, int64(10), tc.size)
+
+	counts := New[string, int](DefaultExpiration, 0, WithMaxBytes[string, int](10, func(k string, v int) int64 {
+		return int64(v)
+	}))
+	counts.Set("a", 5, DefaultExpiration)
+	counts.Set("b", 5, DefaultExpiration)
+	_, err := Increment(counts, "b", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, counts.Keys())
+}
+
+func TestMaxBytesOversizedItem(t *testing.T) {
+	sizer := func(k string, v string) int64 {
+		return int64(len(v))
+	}
+	tc := New[string, string](DefaultExpiration, 0, WithMaxBytes[string, string](4, sizer))
+	tc.Set("a", "12", DefaultExpiration)
+	tc.Set("b", "12", DefaultExpiration)
+	tc.Set("big", "123456", DefaultExpiration)
+	assert.Equal(t, []string{"big"}, tc.Keys(), "oversized item wasn't stored alone")
+	assert.Equal(t, int64(6), tc.size)
+
+	tc.Set("c", "1", DefaultExpiration)
+	assert.Equal(t, []string{"c"}, tc.Keys())
+	assert.Equal(t, int64(1), tc.size)
+}
@@ -0,0 +1,48 @@
+package cache
+
+// Merge copies the unexpired items of other into c. For a key that holds an
+// unexpired item in both caches, conflict is called with c's item and other's
+// item, and the item it returns is stored, so it decides whether the existing
+// item is kept, replaced, or combined with the incoming one (for example, by
+// keeping the one that expires last). If conflict is nil, other's items
+// replace c's, as with Set. Items stored by Merge don't fire the OnEvicted
+// function for the items they replace, which keep their cleanup functions
+// set with SetWithCleanup, and, as with Clone, other's items don't carry
+// theirs into c.
+//
+// The items of other are copied while holding only other's read lock, before
+// c's lock is acquired, so caches can be merged into each other concurrently
+// without deadlocking. Items stored in other while Merge runs may or may not
+// be merged. Merging a cache into itself has no effect other than calling
+// conflict for every item.
+func (c *cache[K, T]) Merge(other *Cache[K, T], conflict func(existing, incoming Item[T]) Item[T]) {
+	if other == nil {
+		return
+	}
+	other.mu.RLock()
+	now := other.now().UnixNano()
+	incoming := make(map[K]Item[T], len(other.items))
+	for k, v := range other.items {
+		// "Inlining" of expired
+		if v.Expiration > 0 && now > v.Expiration {
+			continue
+		}
+		incoming[k] = v
+	}
+	other.mu.RUnlock()
+
+	var evicted []keyAndValue[K, T]
+	c.mu.Lock()
+	for k, v := range incoming {
+		if existing, found := c.items[k]; found && !c.expired(existing) && conflict != nil {
+			v = conflict(existing.exported(), v.exported())
+		}
+		c.store(k, v)
+	}
+	if c.policy != nil {
+		evicted = c.evictOverflow()
+	}
+	hooks := c.hooks()
+	c.mu.Unlock()
+	hooks.fireAll(evicted)
+}
@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	a := New[string, int](DefaultExpiration, 0)
+	b := New[string, int](DefaultExpiration, 0)
+	a.Set("a", 1, DefaultExpiration)
+	a.Set("both", 2, time.Hour)
+	b.Set("both", 3, time.Minute)
+	b.Set("b", 4, DefaultExpiration)
+	b.Set("expired", 5, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+
+	var conflicts int
+	a.Merge(b, func(existing, incoming Item[int]) Item[int] {
+		conflicts++
+		if incoming.Expiration > existing.Expiration {
+			return incoming
+		}
+		return existing
+	})
+	assert.Equal(t, 1, conflicts)
+	assert.Equal(t, map[string]int{"a": 1, "both": 2, "b": 4}, a.GetMany([]string{"a", "both", "b", "expired"}))
+	_, found := b.Get("a")
+	assert.False(t, found, "merged cache was changed")
+
+	a.Merge(b, nil)
+	x, _ := a.Get("both")
+	assert.Equal(t, 3, x)
+}
+
+func TestMergeConcurrent(t *testing.T) {
+	a := New[int, int](DefaultExpiration, 0)
+	b := New[int, int](DefaultExpiration, 0)
+	for i := 0; i < 100; i++ {
+		a.Set(i, i, DefaultExpiration)
+		b.Set(i+100, i, DefaultExpiration)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			a.Merge(b, nil)
+		}()
+		go func() {
+			defer wg.Done()
+			b.Merge(a, nil)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 200, a.ItemCount())
+	assert.Equal(t, 200, b.ItemCount())
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// State describes what a cache knows about a key. See GetWithState.
+type State int
+
+const (
+	// Missing means the cache knows nothing about the key.
+	Missing State = iota
+	// Found means the cache holds an unexpired item for the key.
+	Found
+	// NegativeCached means the key was recorded as absent with SetNegative,
+	// and that record hasn't expired.
+	NegativeCached
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case Missing:
+		return "Missing"
+	case Found:
+		return "Found"
+	case NegativeCached:
+		return "NegativeCached"
+	}
+	return "State(" + strconv.Itoa(int(s)) + ")"
+}
+
+// SetNegative records that the given key is known not to exist, e.g. because
+// a lookup in a backing store came back empty, for the duration d (see Set
+// for the meaning of d). Any existing item for the key is deleted, as with
+// Delete. A negative entry is reported by GetWithState, but for every other
+// method the key is simply not in the cache. Storing an item under the key
+// removes the negative entry.
+func (c *cache[K, T]) SetNegative(k K, d time.Duration) {
+	var e int64
+	d = c.duration(d)
+	if d > 0 {
+		e = c.now().Add(d).UnixNano()
+	}
+	c.mu.Lock()
+	v, cleanup, found := c.delete(k)
+	c.forgetDirty(k)
+	if c.negatives == nil {
+		c.negatives = make(map[K]int64)
+	}
+	c.negatives[k] = e
+	hooks := c.hooks()
+	c.mu.Unlock()
+	if found {
+		atomic.AddUint64(&c.stats.evictions, 1)
+		hooks.fire(k, v.Object, Deleted, cleanup)
+	}
+}
+
+// GetWithState gets an item from the cache and reports whether it was found,
+// whether the key is cached as absent (see SetNegative), or whether the cache
+// knows nothing about it.
+func (c *cache[K, T]) GetWithState(k K) (T, State) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.now().UnixNano()
+	if item, found := c.items[k]; found {
+		// "Inlining" of Expired
+		if item.Expiration <= 0 || now <= item.Expiration {
+			return item.Object, Found
+		}
+	}
+	if e, found := c.negatives[k]; found {
+		if e <= 0 || now <= e {
+			return *new(T), NegativeCached
+		}
+	}
+	return *new(T), Missing
+}
+
+// deleteExpiredNegatives removes expired negative entries. c.mu must be held.
+func (c *cache[K, T]) deleteExpiredNegatives(now int64) {
+	for k, e := range c.negatives {
+		if e > 0 && now > e {
+			delete(c.negatives, k)
+		}
+	}
+}
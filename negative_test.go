@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetWithState(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("found", 1, DefaultExpiration)
+	tc.SetNegative("negative", DefaultExpiration)
+
+	x, state := tc.GetWithState("found")
+	assert.Equal(t, Found, state)
+	assert.Equal(t, 1, x)
+	_, state = tc.GetWithState("negative")
+	assert.Equal(t, NegativeCached, state)
+	_, state = tc.GetWithState("missing")
+	assert.Equal(t, Missing, state)
+
+	_, found := tc.Get("negative")
+	assert.False(t, found, "Get found a negative entry")
+	assert.Equal(t, 1, tc.ItemCount())
+
+	tc.Set("negative", 2, DefaultExpiration)
+	x, state = tc.GetWithState("negative")
+	assert.Equal(t, Found, state, "Set didn't replace the negative entry")
+	assert.Equal(t, 2, x)
+}
+
+func TestSetNegativeDeletesItem(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	var evicted []string
+	tc.OnEvicted(func(k string, v int) {
+		evicted = append(evicted, k)
+	})
+	tc.Set("foo", 1, DefaultExpiration)
+	tc.SetNegative("foo", DefaultExpiration)
+	_, state := tc.GetWithState("foo")
+	assert.Equal(t, NegativeCached, state)
+	assert.Equal(t, []string{"foo"}, evicted)
+}
+
+func TestNegativeExpiration(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, time.Millisecond)
+	defer tc.Close()
+	tc.SetNegative("foo", 5*time.Millisecond)
+	tc.SetNegative("bar", NoExpiration)
+	<-time.After(20 * time.Millisecond)
+	_, state := tc.GetWithState("foo")
+	assert.Equal(t, Missing, state)
+	_, state = tc.GetWithState("bar")
+	assert.Equal(t, NegativeCached, state)
+	tc.mu.RLock()
+	assert.Len(t, tc.negatives, 1, "janitor didn't delete the expired negative entry")
+	tc.mu.RUnlock()
+
+	tc.Flush()
+	_, state = tc.GetWithState("bar")
+	assert.Equal(t, Missing, state)
+}
+
+func TestStateString(t *testing.T) {
+	assert.Equal(t, "Missing", Missing.String())
+	assert.Equal(t, "Found", Found.String())
+	assert.Equal(t, "NegativeCached", NegativeCached.String())
+	assert.Equal(t, "State(7)", State(7).String())
+}
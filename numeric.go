@@ -0,0 +1,121 @@
+package cache
+
+import "fmt"
+
+// Integer is a constraint that permits any integer type, including named
+// types whose underlying type is an integer.
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// Increment atomically adds n to the item stored under k and returns the new
+// value. It returns an error wrapping ErrKeyNotFound if the item doesn't exist
+// or has expired; it never creates the item. The item's expiration is left
+// unchanged.
+//
+// Overflow wraps around exactly like Go's + operator does, e.g. incrementing
+// an int8 holding 127 by 1 yields -128, and no error is returned.
+func Increment[K comparable, T Integer](c *Cache[K, T], k K, n T) (T, error) {
+	c.mu.Lock()
+	v, found := c.items[k]
+	if !found || c.expired(v) {
+		c.mu.Unlock()
+		return 0, fmt.Errorf("%w: %v", ErrKeyNotFound, k)
+	}
+	v.Object += n
+	c.store(k, v)
+	var evicted []keyAndValue[K, T]
+	if c.policy != nil {
+		evicted = c.evictOverflow()
+	}
+	hooks := c.hooks()
+	c.mu.Unlock()
+	hooks.fireAll(evicted)
+	return v.Object, nil
+}
+
+// Decrement atomically subtracts n from the item stored under k and returns
+// the new value. It returns an error wrapping ErrKeyNotFound if the item
+// doesn't exist or has expired; it never creates the item. The item's
+// expiration is left unchanged.
+//
+// Underflow wraps around exactly like Go's - operator does, e.g. decrementing
+// a uint holding 0 by 1 yields the maximum uint, and no error is returned.
+func Decrement[K comparable, T Integer](c *Cache[K, T], k K, n T) (T, error) {
+	c.mu.Lock()
+	v, found := c.items[k]
+	if !found || c.expired(v) {
+		c.mu.Unlock()
+		return 0, fmt.Errorf("%w: %v", ErrKeyNotFound, k)
+	}
+	v.Object -= n
+	c.store(k, v)
+	var evicted []keyAndValue[K, T]
+	if c.policy != nil {
+		evicted = c.evictOverflow()
+	}
+	hooks := c.hooks()
+	c.mu.Unlock()
+	hooks.fireAll(evicted)
+	return v.Object, nil
+}
+
+// Float is a constraint that permits any floating-point type, including named
+// types whose underlying type is a float.
+type Float interface {
+	~float32 | ~float64
+}
+
+// IncrementFloat atomically adds n to the item stored under k and returns the
+// new value. It returns an error wrapping ErrKeyNotFound if the item doesn't
+// exist or has expired; it never creates the item. The item's expiration is
+// left unchanged.
+//
+// The addition follows IEEE 754 rules, so precision is lost as values
+// accumulate: increments that are very small relative to the stored value may
+// have no effect at all (e.g. adding 1 to 1e17), and repeatedly adding values
+// such as 0.1 accumulates rounding error. Use an integer counter of a smaller
+// unit if exact results matter. A stored NaN stays NaN, and adding to an
+// infinity yields that infinity (or NaN when adding the opposite infinity).
+func IncrementFloat[K comparable, T Float](c *Cache[K, T], k K, n T) (T, error) {
+	c.mu.Lock()
+	v, found := c.items[k]
+	if !found || c.expired(v) {
+		c.mu.Unlock()
+		return 0, fmt.Errorf("%w: %v", ErrKeyNotFound, k)
+	}
+	v.Object += n
+	c.store(k, v)
+	var evicted []keyAndValue[K, T]
+	if c.policy != nil {
+		evicted = c.evictOverflow()
+	}
+	hooks := c.hooks()
+	c.mu.Unlock()
+	hooks.fireAll(evicted)
+	return v.Object, nil
+}
+
+// DecrementFloat atomically subtracts n from the item stored under k and
+// returns the new value. It returns an error wrapping ErrKeyNotFound if the
+// item doesn't exist or has expired; it never creates the item. The same
+// precision caveats as for IncrementFloat apply.
+func DecrementFloat[K comparable, T Float](c *Cache[K, T], k K, n T) (T, error) {
+	c.mu.Lock()
+	v, found := c.items[k]
+	if !found || c.expired(v) {
+		c.mu.Unlock()
+		return 0, fmt.Errorf("%w: %v", ErrKeyNotFound, k)
+	}
+	v.Object -= n
+	c.store(k, v)
+	var evicted []keyAndValue[K, T]
+	if c.policy != nil {
+		evicted = c.evictOverflow()
+	}
+	hooks := c.hooks()
+	c.mu.Unlock()
+	hooks.fireAll(evicted)
+	return v.Object, nil
+}
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncrement(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("tint", 1, DefaultExpiration)
+	n, err := Increment(tc, "tint", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	x, found := tc.Get("tint")
+	assert.True(t, found)
+	assert.Equal(t, 3, x)
+}
+
+func TestDecrement(t *testing.T) {
+	tc := New[string, int64](DefaultExpiration, 0)
+	tc.Set("int64", 5, DefaultExpiration)
+	n, err := Decrement(tc, "int64", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	x, found := tc.Get("int64")
+	assert.True(t, found)
+	assert.Equal(t, int64(3), x)
+}
+
+func TestIncrementMissing(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	_, err := Increment(tc, "missing", 1)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	_, found := tc.Get("missing")
+	assert.False(t, found, "Increment created a missing item")
+
+	tc.Set("expired", 1, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+	_, err = Decrement(tc, "expired", 1)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestIncrementOverflow(t *testing.T) {
+	tc := New[string, int8](DefaultExpiration, 0)
+	tc.Set("int8", math.MaxInt8, DefaultExpiration)
+	n, err := Increment(tc, "int8", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int8(math.MinInt8), n)
+
+	uc := New[string, uint](DefaultExpiration, 0)
+	uc.Set("uint", 0, DefaultExpiration)
+	u, err := Decrement(uc, "uint", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(math.MaxUint), u)
+}
+
+func TestIncrementFloat(t *testing.T) {
+	tc := New[string, float64](DefaultExpiration, 0)
+	tc.Set("float64", 1.5, DefaultExpiration)
+	n, err := IncrementFloat(tc, "float64", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 3.5, n)
+
+	n, err = IncrementFloat(tc, "float64", -4)
+	assert.NoError(t, err)
+	assert.Equal(t, -0.5, n)
+
+	n, err = DecrementFloat(tc, "float64", -0.5)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, n)
+}
+
+func TestIncrementFloatSmallIncrements(t *testing.T) {
+	tc := New[string, float64](DefaultExpiration, 0)
+	tc.Set("f", 0, DefaultExpiration)
+	for i := 0; i < 10; i++ {
+		_, _ = IncrementFloat(tc, "f", 0.1)
+	}
+	x, _ := tc.Get("f")
+	assert.InDelta(t, 1.0, x, 1e-9)
+	assert.NotEqual(t, 1.0, x, "expected accumulated rounding error")
+
+	tc.Set("big", 1e17, DefaultExpiration)
+	n, err := IncrementFloat(tc, "big", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1e17, n, "increment below the precision of the value had an effect")
+
+	tc32 := New[string, float32](DefaultExpiration, 0)
+	tc32.Set("f", 1, DefaultExpiration)
+	n32, err := DecrementFloat(tc32, "f", 1e-3)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.999, n32, 1e-6)
+}
+
+func TestIncrementFloatNaNInf(t *testing.T) {
+	tc := New[string, float64](DefaultExpiration, 0)
+	tc.Set("nan", math.NaN(), DefaultExpiration)
+	n, err := IncrementFloat(tc, "nan", 1)
+	assert.NoError(t, err)
+	assert.True(t, math.IsNaN(n))
+
+	tc.Set("inf", math.Inf(1), DefaultExpiration)
+	n, err = DecrementFloat(tc, "inf", 1e300)
+	assert.NoError(t, err)
+	assert.True(t, math.IsInf(n, 1))
+	n, err = IncrementFloat(tc, "inf", math.Inf(-1))
+	assert.NoError(t, err)
+	assert.True(t, math.IsNaN(n))
+}
+
+func TestIncrementFloatMissing(t *testing.T) {
+	tc := New[string, float64](DefaultExpiration, 0)
+	_, err := IncrementFloat(tc, "missing", 1)
+	assert.Error(t, err)
+	tc.Set("expired", 1, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+	_, err = DecrementFloat(tc, "expired", 1)
+	assert.Error(t, err)
+}
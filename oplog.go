@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// OpType describes the kind of operation an Operation records.
+type OpType int
+
+const (
+	// OpSet means an item was stored, e.g. by Set, Add or Replace.
+	OpSet OpType = iota
+	// OpDelete means an item was removed, e.g. by Delete, DeleteExpired or
+	// to keep the cache within its limits.
+	OpDelete
+	// OpFlush means all items were removed or replaced at once, by Flush,
+	// FlushWithEvict or SwapItems. Its Key is the zero value.
+	OpFlush
+	// OpHit means a read, e.g. by Get, found an unexpired item. Reads are
+	// only recorded if WithReadLogging is used.
+	OpHit
+	// OpMiss means a read, e.g. by Get, found no item, or an expired one.
+	OpMiss
+)
+
+// Operation is an entry of a cache's operation log. See WithOperationLog.
+type Operation[K comparable] struct {
+	Type OpType
+	Key  K
+	// Time is when the operation happened, according to the cache's Clock.
+	Time time.Time
+}
+
+// opLog is a ring buffer of the most recent operations on a cache.
+type opLog[K comparable] struct {
+	mu   sync.Mutex
+	ops  []Operation[K]
+	next int
+	full bool
+}
+
+func newOpLog[K comparable](size int) *opLog[K] {
+	return &opLog[K]{ops: make([]Operation[K], size)}
+}
+
+// add records an operation, overwriting the oldest one if the log is full.
+func (l *opLog[K]) add(op Operation[K]) {
+	l.mu.Lock()
+	l.ops[l.next] = op
+	l.next++
+	if l.next == len(l.ops) {
+		l.next = 0
+		l.full = true
+	}
+	l.mu.Unlock()
+}
+
+// logOp records an operation of type t on k, if the cache was created with
+// WithOperationLog.
+func (c *cache[K, T]) logOp(t OpType, k K) {
+	if c.oplog != nil {
+		c.oplog.add(Operation[K]{t, k, c.now()})
+	}
+}
+
+// logRead records a read of k that found an item if found is true, if the
+// cache was created with WithOperationLog and WithReadLogging.
+func (c *cache[K, T]) logRead(k K, found bool) {
+	if c.oplog == nil || !c.logReads {
+		return
+	}
+	if found {
+		c.logOp(OpHit, k)
+	} else {
+		c.logOp(OpMiss, k)
+	}
+}
+
+// OperationLog returns a copy of the most recent operations on the cache,
+// oldest first, if it was created with WithOperationLog, and nil otherwise.
+func (c *cache[K, T]) OperationLog() []Operation[K] {
+	l := c.oplog
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full {
+		return append([]Operation[K](nil), l.ops[:l.next]...)
+	}
+	ops := make([]Operation[K], 0, len(l.ops))
+	ops = append(ops, l.ops[l.next:]...)
+	return append(ops, l.ops[:l.next]...)
+}
@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithOperationLog(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	tc := New[string, int](DefaultExpiration, 0,
+		WithClock[string, int](clock),
+		WithOperationLog[string, int](4))
+	assert.Empty(t, tc.OperationLog())
+
+	tc.Set("a", 1, DefaultExpiration)
+	clock.Advance(time.Second)
+	tc.Get("a")
+	tc.Delete("a")
+	assert.Equal(t, []Operation[string]{
+		{OpSet, "a", start},
+		{OpDelete, "a", start.Add(time.Second)},
+	}, tc.OperationLog())
+
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, DefaultExpiration)
+	tc.Flush()
+	ops := tc.OperationLog()
+	assert.Len(t, ops, 4)
+	assert.Equal(t, OpDelete, ops[0].Type)
+	assert.Equal(t, Operation[string]{OpFlush, "", start.Add(time.Second)}, ops[3])
+
+	// The log is a copy
+	ops[0].Key = "changed"
+	assert.Equal(t, "a", tc.OperationLog()[0].Key)
+
+	assert.Nil(t, New[string, int](DefaultExpiration, 0).OperationLog())
+}
+
+func TestWithReadLogging(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0,
+		WithReadLogging[string, int](),
+		WithOperationLog[string, int](10))
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Get("a")
+	tc.Get("b")
+	var types []OpType
+	for _, op := range tc.OperationLog() {
+		types = append(types, op.Type)
+	}
+	assert.Equal(t, []OpType{OpSet, OpHit, OpMiss}, types)
+
+	tc.Flush()
+	tc.Set("a", 1, DefaultExpiration)
+	tc.GetMany([]string{"a", "b"})
+	tc.GetManyWithExpiration([]string{"b", "a"})
+	var ops []Operation[string]
+	for _, op := range tc.OperationLog()[5:] {
+		ops = append(ops, Operation[string]{Type: op.Type, Key: op.Key})
+	}
+	assert.Equal(t, []Operation[string]{
+		{Type: OpHit, Key: "a"},
+		{Type: OpMiss, Key: "b"},
+		{Type: OpMiss, Key: "b"},
+		{Type: OpHit, Key: "a"},
+	}, ops)
+}
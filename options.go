@@ -0,0 +1,449 @@
+package cache
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Option configures optional behavior of a cache. Options are passed to New()
+// or NewFrom().
+type Option[K comparable, T any] func(*cache[K, T])
+
+// WithMaxItems limits the cache to n items. When an insert would grow the
+// cache beyond n items, the least recently used items (or the items chosen by
+// the policy set with WithEvictionPolicy) are evicted, calling the OnEvicted
+// function if one is set, until it fits again. Reading an item with Get or
+// GetSliding, or writing it, counts as using it. A value of n less than one
+// means the number of items is not limited.
+//
+// Because Get has to record the use of an item, it takes the cache's write
+// lock when the number of items is limited.
+func WithMaxItems[K comparable, T any](n int) Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.maxItems = n
+	}
+}
+
+// WithCapacity makes the cache allocate room for n items up front, so that
+// its map doesn't have to grow as the first n items are stored, as NewFrom
+// allows by passing it a map made with a size hint. For a ShardedCache, every
+// shard allocates room for n items. The option has no effect on a cache
+// created from a non-empty map with NewFrom, or if n is less than one.
+func WithCapacity[K comparable, T any](n int) Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.capacity = n
+	}
+}
+
+// WithoutJanitor makes the cache never start a janitor goroutine, whatever
+// cleanup interval it is created with, and ignore SetCleanupInterval. Expired
+// items are then only deleted by explicit calls to DeleteExpired, but they are
+// never returned by Get and the other read methods either way. Unless another
+// option, such as WithWriteBehind, starts a goroutine of its own, the cache
+// starts no goroutines and sets no finalizer, which makes it cheap to create
+// many short-lived caches.
+func WithoutJanitor[K comparable, T any]() Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.noJanitor = true
+	}
+}
+
+// WithClock makes the cache use the given Clock instead of the system clock to
+// compute and check expiration times. This is mostly useful in tests, together
+// with a FakeClock.
+func WithClock[K comparable, T any](clock Clock) Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.clock = clock
+	}
+}
+
+// WithAdaptiveCleanup makes the janitor adjust its cleanup interval to how
+// many items expire, between min and max: after a sweep that deletes more than
+// a quarter of the cache's items, the interval is halved, and after a sweep
+// that deletes none, it is doubled. The cleanup interval passed to New is the
+// interval the janitor starts with, limited to the bounds; as without the
+// option, no janitor runs if it is less than one. This saves sweeps of caches
+// whose items rarely expire, while keeping up with caches under churn.
+//
+// It has no effect if min is less than one or max is less than min. For a
+// ShardedCache, the janitor adjusts its interval to the items of all shards.
+func WithAdaptiveCleanup[K comparable, T any](min, max time.Duration) Option[K, T] {
+	return func(c *cache[K, T]) {
+		if min > 0 && max >= min {
+			c.adaptive = &adaptiveCleanup{min, max}
+		}
+	}
+}
+
+// WithCoarseClock makes the cache use a CoarseClock that reads the system clock
+// every resolution, instead of reading it whenever an expiration time is
+// computed or checked. This speeds up hot read paths such as Get, whose cost
+// is otherwise dominated by time.Now, but items may then expire up to
+// resolution late, and items set within the same tick get the same expiration
+// time. The clock's goroutine is stopped when the cache is closed or garbage
+// collected. It has no effect if resolution is less than one.
+func WithCoarseClock[K comparable, T any](resolution time.Duration) Option[K, T] {
+	return func(c *cache[K, T]) {
+		if resolution > 0 {
+			c.coarse = NewCoarseClock(resolution)
+			c.clock = c.coarse
+		}
+	}
+}
+
+// WithMaxBytes limits the approximate size of the cache to maxBytes bytes, as
+// measured by sizer, which must return the size of an item and must always
+// return the same size for the same key and value. When an insert would grow
+// the cache beyond maxBytes, the least recently used items are evicted
+// (calling the OnEvicted function, if one is set) until it fits again, as with
+// WithMaxItems.
+//
+// An item that is larger than maxBytes on its own is still stored, but every
+// other item is evicted to make room for it, so the cache briefly holds more
+// than maxBytes bytes until the item is removed or replaced.
+func WithMaxBytes[K comparable, T any](maxBytes int64, sizer func(K, T) int64) Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.maxBytes = maxBytes
+		c.sizer = sizer
+	}
+}
+
+// WithLoader makes Get load items that are missing or have expired by calling
+// loader, which returns the value and the duration to store it with (see Set
+// for the meaning of the duration). Concurrent Gets of the same missing key
+// share a single call to loader. If loader returns an error, nothing is stored
+// and Get reports the item as not found; use GetOrCompute if the error is
+// needed. Use Peek to read an item without loading it.
+//
+// Only Get and GetContext load items; the other read methods, such as
+// GetWithExpiration and GetMany, behave as if no loader was set.
+func WithLoader[K comparable, T any](loader func(K) (T, time.Duration, error)) Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.loader = loader
+	}
+}
+
+// WithLoaderConcurrency limits the number of calls to the loader set with
+// WithLoader that run at the same time to n, so that a burst of misses for
+// many different keys doesn't overwhelm the backend the loader reads from.
+// Loads beyond the limit wait in line for a running load to finish; their
+// number is reported by Stats().LoaderQueued. This is in addition to sharing
+// a single load between concurrent Gets of the same key. Use GetContext to
+// stop waiting when a context is done. For a ShardedCache, the limit applies
+// to each shard. It has no effect if n is less than one.
+func WithLoaderConcurrency[K comparable, T any](n int) Option[K, T] {
+	return func(c *cache[K, T]) {
+		if n > 0 {
+			c.loadLimit = newLoadLimiter(n)
+		}
+	}
+}
+
+// WithExpirationJitter adds a random offset between 0 and maxJitter to the
+// expiration time of every item stored with Set, SetMany, Add, Replace and the
+// other methods that set a new duration, so that items stored at the same
+// time with the same duration don't all expire at once. Items that never
+// expire are unaffected, as are items whose expiration is extended with Touch
+// or GetSliding.
+//
+// The offsets are drawn from src, which may be seeded to make them
+// deterministic in tests. If src is nil, a source seeded with the current time
+// is used.
+func WithExpirationJitter[K comparable, T any](maxJitter time.Duration, src rand.Source) Option[K, T] {
+	if src == nil {
+		src = rand.NewSource(time.Now().UnixNano())
+	}
+	r := &lockedRand{r: rand.New(src)}
+	return func(c *cache[K, T]) {
+		c.maxJitter = maxJitter
+		c.jitterRand = r
+	}
+}
+
+// WithMaxTTL limits how long any item can live to max, regardless of the
+// duration passed to Set, Add, Replace and the other methods that store or
+// renew items. Longer durations, including NoExpiration and a default
+// expiration that is longer than max (or never expires), are clamped to max.
+// This protects a shared cache from callers that accidentally store items
+// forever. Items passed to NewFrom or loaded with Load keep their expiration
+// times. A value of max less than one means durations are not limited.
+func WithMaxTTL[K comparable, T any](max time.Duration) Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.maxTTL = max
+	}
+}
+
+// WithErrorCaching makes GetOrCompute, GetOrLoadContext and the loader set with
+// WithLoader remember an error returned while computing an item for errorTTL,
+// so that a failing backend isn't called again for every request. Until the
+// error expires, these methods return it again (or, for Get with a loader,
+// report the item as not found) without computing the item. The error is not
+// stored as an item; storing a value for the key, e.g. with Set, forgets it.
+// A value of errorTTL less than one means errors are not cached.
+func WithErrorCaching[K comparable, T any](errorTTL time.Duration) Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.errorTTL = errorTTL
+	}
+}
+
+// WithEvictionPolicy makes a cache whose size is limited with WithMaxItems or
+// WithMaxBytes use the EvictionPolicy returned by newPolicy to choose which
+// items to evict, instead of evicting the least recently used ones, e.g.
+//
+//	WithEvictionPolicy[string, int](NewLFUPolicy[string])
+//
+// newPolicy is called again whenever the cache is flushed, and once for every
+// shard of a ShardedCache, so it must return a new policy each time. The
+// option has no effect if the size of the cache isn't limited.
+func WithEvictionPolicy[K comparable, T any](newPolicy func() EvictionPolicy[K]) Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.newPolicy = newPolicy
+	}
+}
+
+// WithAsyncCallbacks makes the cache run the OnEvicted, OnExpired and
+// OnEvictedReason functions and the cleanup functions set with SetWithCleanup
+// on a separate goroutine, so that methods such as Delete and DeleteExpired
+// return without waiting for slow callbacks. By default, the callbacks run on
+// the goroutine of the method that evicted the items.
+//
+// The callbacks run one at a time, in the order in which the items were
+// evicted: if one method call returns before another one starts, e.g.
+// because both are made by the same goroutine, the callbacks for the items
+// evicted by the first call run first. In particular, the callbacks for a
+// single key run in order unless the key is modified concurrently. Events
+// for subscribers (see Subscribe), including those of stored items, are
+// delivered by the same goroutine, so they keep that order too.
+//
+// At most queueSize callbacks (at least one) wait to be run. When the queue is
+// full, the method that evicts an item blocks until there is room, so that no
+// callbacks are lost. Because of this, a callback must not store or delete
+// items in the same cache, as it could wait for itself to finish. Events of
+// stored items are queued while holding the cache's lock, so they don't wait
+// and may briefly exceed queueSize. The goroutine only runs while callbacks
+// are queued, so the cache doesn't need to be closed to stop it.
+func WithAsyncCallbacks[K comparable, T any](queueSize int) Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.async = newDispatcher(queueSize)
+	}
+}
+
+// WithMetricsObserver makes the cache notify o of every hit and miss of a read
+// method that counts towards Stats (such as Get, GetItem, GetSliding and
+// GetMany), and of every item that is evicted for any reason, including items
+// that are overwritten.
+//
+// The observer's methods are called synchronously on the goroutine of the
+// method that caused them (or, for evictions, on the goroutine that runs the
+// eviction callbacks, see WithAsyncCallbacks), after the cache's lock has
+// been released. They add their own cost to every read, so they should be as
+// cheap as incrementing a counter.
+func WithMetricsObserver[K comparable, T any](o MetricsObserver[K]) Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.observer = o
+	}
+}
+
+// WithExpirationBatchSize makes DeleteExpired, and so the janitor, delete the
+// expired items of the cache in batches of at most n items, releasing the
+// cache's lock between batches so that other goroutines can use the cache.
+// Without it, DeleteExpired holds the lock while it scans every item, which
+// for large caches can block other goroutines for a long time. With it, the
+// items are scanned while holding only the read lock, and a sweep takes
+// somewhat longer in total. Items that expire while a sweep is in progress
+// are left for the next one. The option has no effect if n is less than one.
+func WithExpirationBatchSize[K comparable, T any](n int) Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.expireBatch = n
+	}
+}
+
+// WithExpiryInspector makes DeleteExpired, and so the janitor, call inspect
+// for every expired item before deleting it. If inspect returns false, the
+// item is kept until the next sweep, when inspect is called for it again;
+// meanwhile it is still not returned by Get and the other read methods, as
+// it has expired. inspect is called without holding the cache's lock, so it
+// may be slow, or use the cache. An item that is stored again or touched
+// while inspect runs isn't deleted.
+func WithExpiryInspector[K comparable, T any](inspect func(K, T) bool) Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.inspector = inspect
+	}
+}
+
+// WithExpirationChannel makes DeleteExpired, and so the janitor, send every
+// expired item it deletes on a channel with a buffer of buf items, which is
+// returned by the cache's ExpirationChannel method, so that expirations can be
+// handled in a select loop instead of an OnExpired function. The items are
+// sent without blocking: when the buffer is full, they are dropped and
+// counted in Stats().DroppedExpirations. The channel is closed by Close.
+//
+// The option is meant for a Cache; the shards of a ShardedCache would each
+// get a channel of their own that can't be received from.
+func WithExpirationChannel[K comparable, T any](buf int) Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.expiredCh = make(chan KeyValue[K, T], buf)
+	}
+}
+
+// WithWriteBehind makes the cache buffer the changes made to it and pass them
+// to flush in batches, every interval and once more when the cache is closed,
+// turning the cache into a write-behind buffer for a backing store. flush is
+// called on a separate goroutine with the latest value of every key written
+// (by Set, Add, Replace, Increment and so on) since the last successful
+// flush, including items that have since expired or been evicted to make
+// room, and with the keys deleted explicitly since then (by Delete,
+// GetAndDelete, PopN, DeleteFunc, Rename and so on), which should be deleted
+// from the backing store. A key is passed either as written or as deleted,
+// depending on what happened to it last. Keys removed by Flush or SwapItems
+// aren't passed as deleted, and their pending writes are dropped. FlushDirty
+// flushes immediately.
+//
+// If flush returns an error, the batch is kept and retried with the next one,
+// and the interval between attempts doubles with every consecutive failure,
+// up to 32 times interval, until a flush succeeds. Failed flushes are counted
+// in Stats().WriteBehindFailures. Close waits for the last flush to finish,
+// but a failure of that flush isn't retried.
+//
+// Calls to flush don't overlap for a cache, but may for the shards of a
+// ShardedCache. The option has no effect if interval is less than one.
+func WithWriteBehind[K comparable, T any](flush func(written map[K]T, deleted []K) error, interval time.Duration) Option[K, T] {
+	return func(c *cache[K, T]) {
+		if interval > 0 {
+			c.writeBehind = newWriteBehind(flush, interval)
+		}
+	}
+}
+
+// WithPeriodicSnapshot makes the cache save its unexpired items to the file
+// fname every interval, and once more when it is closed, so that they can be
+// restored with LoadFile after a restart. Snapshots are written by a separate
+// goroutine in the format of SaveFile: the items are copied while holding the
+// cache's read lock, and encoded and written after it has been released. Each
+// snapshot is written to a temporary file in the same directory first, which
+// then replaces fname, so fname always holds a complete snapshot. Errors are
+// passed to onError, if it isn't nil.
+//
+// The option is meant for a Cache; the shards of a ShardedCache would all
+// write to the same file. It has no effect if interval is less than one.
+func WithPeriodicSnapshot[K comparable, T any](fname string, interval time.Duration, onError func(error)) Option[K, T] {
+	return func(c *cache[K, T]) {
+		if interval > 0 {
+			c.snapshot = newSnapshotter[K, T](fname, interval, onError)
+		}
+	}
+}
+
+// WithHeapPressureEviction makes the cache evict items whenever the process's
+// heap grows beyond thresholdBytes, as a best-effort limit on memory use for
+// caches without a sizer (see WithMaxBytes). A separate goroutine reads
+// runtime.MemStats every interval, and if HeapAlloc exceeds the threshold,
+// evicts the share of the items by which it does, but at least one: e.g. a
+// tenth of the items if the heap is 10% over. The items that were stored
+// longest ago are evicted first, or those chosen by the eviction policy if
+// WithMaxItems or WithMaxBytes is also used, with the reason CapacityEvicted.
+//
+// This is approximate in every respect: the heap includes memory that isn't
+// used by the cache and garbage that hasn't been collected yet, so it only
+// shrinks after the next garbage collection, the items may not take up the
+// heap in proportion to their number, and the cache may exceed the threshold
+// for up to interval. runtime.ReadMemStats also briefly stops the world, so
+// interval shouldn't be too short. For a ShardedCache, each shard checks the
+// heap and evicts its share of items on its own. It has no effect if
+// thresholdBytes is 0 or interval is less than one.
+func WithHeapPressureEviction[K comparable, T any](thresholdBytes uint64, interval time.Duration) Option[K, T] {
+	return func(c *cache[K, T]) {
+		if thresholdBytes > 0 && interval > 0 {
+			c.heap = newHeapWatcher[K, T](thresholdBytes, interval)
+		}
+	}
+}
+
+// WithRefreshAhead makes the janitor reload items that are about to expire,
+// so that frequently used items are replaced with fresh values before they
+// expire rather than after. Every cleanup interval, after deleting the
+// expired items, the janitor calls reload, each on its own goroutine, for
+// every unexpired item that expires within window, with its key and current
+// value. reload returns the new value and the duration to store it with (see
+// Set), which replaces the item as Set does, unless the item has been
+// replaced or deleted while reload ran. If reload returns an error, the item
+// is left to expire.
+//
+// An item is only reloaded once at a time, however long reload takes. Items
+// are only refreshed while the janitor runs, so the cleanup interval should
+// be well below window. The option has no effect if window is less than one.
+func WithRefreshAhead[K comparable, T any](window time.Duration, reload func(K, T) (T, time.Duration, error)) Option[K, T] {
+	return func(c *cache[K, T]) {
+		if window > 0 {
+			c.refresh = newRefreshAhead(window, reload)
+		}
+	}
+}
+
+// WithRecoverCallbacks makes the cache recover from panics in the functions
+// it calls for evicted items (those set with OnEvicted, OnExpired and
+// OnEvictedReason, the cleanup functions set with SetWithCleanup, and the
+// OnEviction method of a MetricsObserver), and pass them to handle as errors
+// instead. Without it, such a panic propagates to the method that evicted the
+// item, e.g. Delete, and crashes the program if it happens on the janitor's
+// goroutine or, with WithAsyncCallbacks, on the goroutine that runs the
+// callbacks.
+//
+// Recovering keeps the cache working, but hides the panic from the code that
+// caused the eviction, and whatever the panicking function was doing is left
+// half done; handle should at least log the error. The other functions for
+// the item are still called.
+func WithRecoverCallbacks[K comparable, T any](handle func(error)) Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.onPanic = handle
+	}
+}
+
+// WithValidator makes Add, AddOrGet, Replace and SetValidated call validate
+// with the key and value before storing a value, and refuse to store it,
+// returning validate's error, if that isn't nil. validate is called without
+// holding the cache's lock. Other methods that store values, such as Set,
+// Update or the loader set with WithLoader, don't call it.
+func WithValidator[K comparable, T any](validate func(K, T) error) Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.validator = validate
+	}
+}
+
+// WithValueHasher makes the cache count the distinct values among its items,
+// as reported by Stats().UniqueValues, to find out whether the same value is
+// stored under many keys. Values are told apart by the hashes hash returns
+// for them, so values with colliding hashes are counted once. hash is called
+// for every value that is stored or removed, while holding the cache's lock,
+// so it should be fast.
+func WithValueHasher[K comparable, T any](hash func(T) uint64) Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.values = newValueCounts(hash)
+	}
+}
+
+// WithOperationLog makes the cache record its most recent size operations in
+// a ring buffer, returned by OperationLog, as a lightweight trail for
+// debugging: every item stored (OpSet), removed for any reason (OpDelete) or
+// flushed (OpFlush), with its key and time. Reads are only recorded if
+// WithReadLogging is used too. Each operation is recorded while holding a
+// lock of its own, which adds to the cost of every write. It has no effect if
+// size is less than one.
+func WithOperationLog[K comparable, T any](size int) Option[K, T] {
+	return func(c *cache[K, T]) {
+		if size > 0 {
+			c.oplog = newOpLog[K](size)
+		}
+	}
+}
+
+// WithReadLogging makes a cache created with WithOperationLog also record
+// reads that count towards Stats, such as Get, as OpHit or OpMiss. This fills
+// the log much faster in a cache that is read more often than written. It
+// has no effect without WithOperationLog, which may be passed before or
+// after it.
+func WithReadLogging[K comparable, T any]() Option[K, T] {
+	return func(c *cache[K, T]) {
+		c.logReads = true
+	}
+}
@@ -0,0 +1,63 @@
+package cache
+
+import "time"
+
+// ReadOnlyCache is a view of a cache that can be read, but not modified.
+type ReadOnlyCache[K comparable, T any] interface {
+	// Get gets an item from the cache. See Cache.Get.
+	Get(k K) (T, bool)
+	// Contains reports whether an unexpired item exists for a key. See
+	// Cache.Contains.
+	Contains(k K) bool
+	// GetWithExpiration gets an item and its expiration time from the
+	// cache. See Cache.GetWithExpiration.
+	GetWithExpiration(k K) (T, time.Time, bool)
+	// Items copies all unexpired items in the cache into a new map. See
+	// Cache.Items.
+	Items() map[K]Item[T]
+	// Keys returns the keys of all unexpired items in the cache. See
+	// Cache.Keys.
+	Keys() []K
+	// ItemCount returns the number of items in the cache. See
+	// Cache.ItemCount.
+	ItemCount() int
+}
+
+// readOnly wraps a cache so that callers can't get at its other methods with
+// a type assertion.
+type readOnly[K comparable, T any] struct {
+	c *cache[K, T]
+}
+
+// ReadOnly returns a view of the cache that only allows reading it, to hand
+// to code that must not modify the cache. The view reads the same items as
+// the cache, without copying them. Note that reading an item still records
+// its use for the eviction policy, and that Get loads missing items if the
+// cache was created with WithLoader.
+func (c *cache[K, T]) ReadOnly() ReadOnlyCache[K, T] {
+	return readOnly[K, T]{c}
+}
+
+func (r readOnly[K, T]) Get(k K) (T, bool) {
+	return r.c.Get(k)
+}
+
+func (r readOnly[K, T]) Contains(k K) bool {
+	return r.c.Contains(k)
+}
+
+func (r readOnly[K, T]) GetWithExpiration(k K) (T, time.Time, bool) {
+	return r.c.GetWithExpiration(k)
+}
+
+func (r readOnly[K, T]) Items() map[K]Item[T] {
+	return r.c.Items()
+}
+
+func (r readOnly[K, T]) Keys() []K {
+	return r.c.Keys()
+}
+
+func (r readOnly[K, T]) ItemCount() int {
+	return r.c.ItemCount()
+}
@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOnly(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	ro := tc.ReadOnly()
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, time.Hour)
+
+	x, found := ro.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, 1, x)
+	_, exp, found := ro.GetWithExpiration("b")
+	assert.True(t, found)
+	assert.False(t, exp.IsZero())
+	assert.True(t, ro.Contains("b"))
+	assert.ElementsMatch(t, []string{"a", "b"}, ro.Keys())
+	assert.Equal(t, 2, len(ro.Items()))
+
+	// The view sees later changes to the cache
+	tc.Delete("a")
+	assert.Equal(t, 1, ro.ItemCount())
+
+	_, ok := ro.(interface{ Set(string, int, time.Duration) })
+	assert.False(t, ok, "the read-only view can be modified")
+}
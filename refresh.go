@@ -0,0 +1,97 @@
+package cache
+
+import "time"
+
+// refreshAhead is the configuration set by WithRefreshAhead.
+type refreshAhead[K comparable, T any] struct {
+	window time.Duration
+	reload func(K, T) (T, time.Duration, error)
+	// refreshing holds the keys being reloaded. It is protected by the
+	// cache's flightMu.
+	refreshing map[K]struct{}
+}
+
+func newRefreshAhead[K comparable, T any](window time.Duration, reload func(K, T) (T, time.Duration, error)) *refreshAhead[K, T] {
+	return &refreshAhead[K, T]{
+		window:     window,
+		reload:     reload,
+		refreshing: make(map[K]struct{}),
+	}
+}
+
+// sweep is what the janitor does every cleanup interval: it deletes expired
+// items and starts reloading items that are about to expire.
+func (c *cache[K, T]) sweep() {
+	c.DeleteExpired()
+	if c.refresh != nil {
+		c.refreshExpiring()
+	}
+}
+
+// refreshExpiring starts reloading every unexpired item that expires within
+// the refresh window and isn't being reloaded already, each on its own
+// goroutine.
+func (c *cache[K, T]) refreshExpiring() {
+	r := c.refresh
+	now := c.now().UnixNano()
+	limit := now + int64(r.window)
+	var due []KeyValue[K, Item[T]]
+	c.mu.RLock()
+	for k, v := range c.items {
+		if v.Expiration > 0 && now <= v.Expiration && v.Expiration <= limit {
+			due = append(due, KeyValue[K, Item[T]]{k, v})
+		}
+	}
+	c.mu.RUnlock()
+	for _, kv := range due {
+		c.flightMu.Lock()
+		_, busy := r.refreshing[kv.Key]
+		if !busy {
+			r.refreshing[kv.Key] = struct{}{}
+		}
+		c.flightMu.Unlock()
+		if !busy {
+			go c.reload(kv.Key, kv.Value)
+		}
+	}
+}
+
+// reload reloads the item seen stored under k, and stores the result unless
+// the item has been replaced or deleted in the meantime.
+func (c *cache[K, T]) reload(k K, seen Item[T]) {
+	defer func() {
+		c.flightMu.Lock()
+		delete(c.refresh.refreshing, k)
+		c.flightMu.Unlock()
+	}()
+	x, d, err := c.refresh.reload(k, seen.Object)
+	if err != nil {
+		return
+	}
+	var e int64
+	d = c.duration(d)
+	if d > 0 {
+		e = c.now().Add(d + c.jitter()).UnixNano()
+	}
+	c.mu.Lock()
+	old, found := c.items[k]
+	if !found || old.version != seen.version {
+		c.mu.Unlock()
+		return
+	}
+	cleanup := c.cleanups[k]
+	c.store(k, Item[T]{
+		Object:     x,
+		Expiration: e,
+		ttl:        d,
+	})
+	c.setCleanup(k, nil)
+	var evicted []keyAndValue[K, T]
+	if c.policy != nil {
+		evicted = c.evictOverflow()
+	}
+	hooks := c.hooks()
+	c.mu.Unlock()
+	hooks.fire(k, old.Object, Replaced, cleanup)
+	hooks.fireAll(evicted)
+}
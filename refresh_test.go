@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRefreshAhead(t *testing.T) {
+	clock := NewFakeClock(time.Date(2022, 6, 16, 0, 0, 0, 0, time.UTC))
+	var calls int32
+	release := make(chan struct{})
+	tc := New[string, int](DefaultExpiration, 0,
+		WithClock[string, int](clock),
+		WithRefreshAhead[string, int](time.Minute, func(k string, v int) (int, time.Duration, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			if k == "failing" {
+				return 0, 0, errors.New("unavailable")
+			}
+			return v + 1, time.Hour, nil
+		}))
+	tc.Set("a", 1, 2*time.Minute)
+	tc.Set("failing", 2, 2*time.Minute)
+	tc.Set("later", 3, time.Hour)
+	tc.Set("forever", 4, NoExpiration)
+
+	tc.sweep()
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls), "items were refreshed too early")
+
+	clock.Advance(90 * time.Second)
+	tc.sweep()
+	tc.sweep()
+	close(release)
+	assert.Eventually(t, func() bool {
+		x, _ := tc.Get("a")
+		return x == 2
+	}, 5*time.Second, time.Millisecond, "item wasn't refreshed")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "items were refreshed more than once at a time")
+	ttl, _ := tc.TTL("a")
+	assert.Equal(t, time.Hour, ttl)
+
+	clock.Advance(time.Minute)
+	_, found := tc.Get("failing")
+	assert.False(t, found)
+	x, _ := tc.Get("later")
+	assert.Equal(t, 3, x)
+}
+
+func TestWithRefreshAheadReplaced(t *testing.T) {
+	clock := NewFakeClock(time.Date(2022, 6, 16, 0, 0, 0, 0, time.UTC))
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	tc := New[string, int](DefaultExpiration, 0,
+		WithClock[string, int](clock),
+		WithRefreshAhead[string, int](time.Minute, func(k string, v int) (int, time.Duration, error) {
+			defer close(done)
+			close(started)
+			<-release
+			return 0, time.Hour, nil
+		}))
+	tc.Set("a", 1, time.Second)
+	tc.sweep()
+	<-started
+	tc.Set("a", 2, time.Second)
+	close(release)
+	<-done
+	// Wait for the goroutine to release the key
+	assert.Eventually(t, func() bool {
+		tc.flightMu.Lock()
+		defer tc.flightMu.Unlock()
+		return len(tc.refresh.refreshing) == 0
+	}, 5*time.Second, time.Millisecond)
+	x, _ := tc.Get("a")
+	assert.Equal(t, 2, x, "refresh overwrote a newer value")
+}
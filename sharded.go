@@ -0,0 +1,410 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ShardedCache is a cache whose items are spread across a number of
+// independent shards, each with its own lock, to reduce lock contention when
+// the cache is used by many goroutines at once.
+type ShardedCache[K comparable, T any] struct {
+	*shardedCache[K, T]
+	// See the comment in newCacheWithJanitor for why this wrapper exists
+}
+
+type shardedCache[K comparable, T any] struct {
+	hasher    func(K) uint64
+	cs        []*cache[K, T]
+	janitor   *shardedJanitor[K, T]
+	closeOnce sync.Once
+}
+
+// NewHasher returns a hash function for keys of type K, suitable for use with
+// NewSharded. Strings, integers and floating-point numbers are hashed
+// directly, with 0 and -0 hashing alike since they are equal keys; any other
+// key type is hashed by its fmt %#v representation, which is slow, so callers
+// with such key types should consider supplying their own hash function. That
+// representation is correct for all comparable types except those containing
+// floating-point numbers, for which 0 and -0 hash differently. The hash is
+// seeded randomly, so it differs between processes.
+func NewHasher[K comparable]() func(K) uint64 {
+	seed := maphash.MakeSeed()
+	return func(k K) uint64 {
+		var h maphash.Hash
+		h.SetSeed(seed)
+		var u uint64
+		switch v := any(k).(type) {
+		case string:
+			_, _ = h.WriteString(v)
+			return h.Sum64()
+		case int:
+			u = uint64(v)
+		case int64:
+			u = uint64(v)
+		case int32:
+			u = uint64(v)
+		case int16:
+			u = uint64(v)
+		case int8:
+			u = uint64(v)
+		case uint:
+			u = uint64(v)
+		case uint64:
+			u = v
+		case uint32:
+			u = uint64(v)
+		case uint16:
+			u = uint64(v)
+		case uint8:
+			u = uint64(v)
+		case uintptr:
+			u = uint64(v)
+		case float64:
+			u = floatBits(v)
+		case float32:
+			u = floatBits(float64(v))
+		default:
+			_, _ = fmt.Fprintf(&h, "%#v", v)
+			return h.Sum64()
+		}
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], u)
+		_, _ = h.Write(b[:])
+		return h.Sum64()
+	}
+}
+
+// floatBits returns the bits of f for hashing, with -0 turned into 0 so that
+// equal keys hash alike. NaN keys never equal each other, so their hash
+// doesn't matter.
+func floatBits(f float64) uint64 {
+	if f == 0 {
+		f = 0
+	}
+	return math.Float64bits(f)
+}
+
+func (sc *shardedCache[K, T]) bucket(k K) *cache[K, T] {
+	return sc.cs[sc.hasher(k)%uint64(len(sc.cs))]
+}
+
+// Set an item to the cache, replacing any existing item. See Cache.Set.
+func (sc *shardedCache[K, T]) Set(k K, x T, d time.Duration) {
+	sc.bucket(k).Set(k, x, d)
+}
+
+// SetWithCleanup is like Set, but also stores a cleanup function with the
+// item. See Cache.SetWithCleanup.
+func (sc *shardedCache[K, T]) SetWithCleanup(k K, x T, d time.Duration, cleanup func(T)) {
+	sc.bucket(k).SetWithCleanup(k, x, d, cleanup)
+}
+
+// SetValidated is like Set, but returns the error of a validator set with
+// WithValidator that rejects x. See Cache.SetValidated.
+func (sc *shardedCache[K, T]) SetValidated(k K, x T, d time.Duration) error {
+	return sc.bucket(k).SetValidated(k, x, d)
+}
+
+// SetDefault an item to the cache, replacing any existing item, using the
+// default expiration.
+func (sc *shardedCache[K, T]) SetDefault(k K, x T) {
+	sc.bucket(k).SetDefault(k, x)
+}
+
+// Add an item to the cache only if an item doesn't already exist for the given
+// key, or if the existing item has expired. Returns an error otherwise.
+func (sc *shardedCache[K, T]) Add(k K, x T, d time.Duration) error {
+	return sc.bucket(k).Add(k, x, d)
+}
+
+// SetIfAbsent stores an item only if it doesn't already exist and returns the
+// winning value. See Cache.SetIfAbsent.
+func (sc *shardedCache[K, T]) SetIfAbsent(k K, x T, d time.Duration) (T, bool) {
+	return sc.bucket(k).SetIfAbsent(k, x, d)
+}
+
+// SetAbsolute adds an item to the cache that expires at the given time. See
+// Cache.SetAbsolute.
+func (sc *shardedCache[K, T]) SetAbsolute(k K, x T, at time.Time) {
+	sc.bucket(k).SetAbsolute(k, x, at)
+}
+
+// SetNX stores an item only if it doesn't already exist, and reports whether
+// it did. See Cache.SetNX.
+func (sc *shardedCache[K, T]) SetNX(k K, x T, d time.Duration) bool {
+	return sc.bucket(k).SetNX(k, x, d)
+}
+
+// AddOrGet stores an item only if it doesn't already exist, and otherwise
+// returns the existing one with an error. See Cache.AddOrGet.
+func (sc *shardedCache[K, T]) AddOrGet(k K, x T, d time.Duration) (T, bool, error) {
+	return sc.bucket(k).AddOrGet(k, x, d)
+}
+
+// Replace a new value for the cache key only if it already exists, and the
+// existing item hasn't expired. Returns an error otherwise.
+func (sc *shardedCache[K, T]) Replace(k K, x T, d time.Duration) error {
+	return sc.bucket(k).Replace(k, x, d)
+}
+
+// Get an item from the cache. Returns the item or nil, and a bool indicating
+// whether the key was found.
+func (sc *shardedCache[K, T]) Get(k K) (T, bool) {
+	return sc.bucket(k).Get(k)
+}
+
+// GetContext is like Get, but waiting for the item to be loaded can be
+// canceled with ctx. See Cache.GetContext.
+func (sc *shardedCache[K, T]) GetContext(ctx context.Context, k K) (T, bool) {
+	return sc.bucket(k).GetContext(ctx, k)
+}
+
+// Peek is like Get, but never calls the loader set with WithLoader.
+func (sc *shardedCache[K, T]) Peek(k K) (T, bool) {
+	return sc.bucket(k).Peek(k)
+}
+
+// Contains reports whether an unexpired item exists for the given key. See
+// Cache.Contains.
+func (sc *shardedCache[K, T]) Contains(k K) bool {
+	return sc.bucket(k).Contains(k)
+}
+
+// GetItem returns an item, including its expiration time, from the cache. See
+// Cache.GetItem.
+func (sc *shardedCache[K, T]) GetItem(k K) (Item[T], bool) {
+	return sc.bucket(k).GetItem(k)
+}
+
+// GetWithExpiration returns an item and its expiration time from the cache.
+// See Cache.GetWithExpiration.
+func (sc *shardedCache[K, T]) GetWithExpiration(k K) (T, time.Time, bool) {
+	return sc.bucket(k).GetWithExpiration(k)
+}
+
+// Delete an item from the cache. Does nothing if the key is not in the cache.
+func (sc *shardedCache[K, T]) Delete(k K) {
+	sc.bucket(k).Delete(k)
+}
+
+// DeleteExpired deletes all expired items from every shard.
+func (sc *shardedCache[K, T]) DeleteExpired() {
+	for _, v := range sc.cs {
+		v.DeleteExpired()
+	}
+}
+
+// OnEvicted sets an (optional) function that is called with the key and value
+// when an item is evicted from any of the shards. See Cache.OnEvicted.
+func (sc *shardedCache[K, T]) OnEvicted(f func(K, T)) {
+	for _, v := range sc.cs {
+		v.OnEvicted(f)
+	}
+}
+
+// Items copies all unexpired items in all shards into a new map and returns
+// it. The shards are copied one after another, so the result isn't a
+// consistent snapshot of the whole cache.
+func (sc *shardedCache[K, T]) Items() map[K]Item[T] {
+	res := make(map[K]Item[T], sc.ItemCount())
+	for _, v := range sc.cs {
+		for k, item := range v.Items() {
+			res[k] = item
+		}
+	}
+	return res
+}
+
+// Keys returns the keys of all unexpired items in all shards, in no particular
+// order.
+func (sc *shardedCache[K, T]) Keys() []K {
+	keys := make([]K, 0, sc.ItemCount())
+	for _, v := range sc.cs {
+		keys = append(keys, v.Keys()...)
+	}
+	return keys
+}
+
+// ItemCount returns the number of items in all shards. This may include items
+// that have expired, but have not yet been cleaned up.
+func (sc *shardedCache[K, T]) ItemCount() int {
+	n := 0
+	for _, v := range sc.cs {
+		n += v.ItemCount()
+	}
+	return n
+}
+
+// CountUnexpired returns the number of unexpired items in all shards. See
+// Cache.CountUnexpired.
+func (sc *shardedCache[K, T]) CountUnexpired() int {
+	n := 0
+	for _, v := range sc.cs {
+		n += v.CountUnexpired()
+	}
+	return n
+}
+
+// ExpiredCount returns the number of expired items that haven't been deleted
+// yet in all shards. See Cache.ExpiredCount.
+func (sc *shardedCache[K, T]) ExpiredCount() int {
+	n := 0
+	for _, v := range sc.cs {
+		n += v.ExpiredCount()
+	}
+	return n
+}
+
+// DefaultExpiration returns the duration that items stored with
+// DefaultExpiration are stored with. See Cache.DefaultExpiration.
+func (sc *shardedCache[K, T]) DefaultExpiration() time.Duration {
+	return sc.cs[0].DefaultExpiration()
+}
+
+// SetDefaultExpiration changes the default expiration of all shards. See
+// Cache.SetDefaultExpiration.
+func (sc *shardedCache[K, T]) SetDefaultExpiration(d time.Duration) {
+	for _, v := range sc.cs {
+		v.SetDefaultExpiration(d)
+	}
+}
+
+// Cap returns the sum of the Cap of all shards. See Cache.Cap.
+func (sc *shardedCache[K, T]) Cap() int {
+	n := 0
+	for _, v := range sc.cs {
+		n += v.Cap()
+	}
+	return n
+}
+
+// Flush deletes all items from every shard.
+func (sc *shardedCache[K, T]) Flush() {
+	for _, v := range sc.cs {
+		v.Flush()
+	}
+}
+
+type shardedJanitor[K comparable, T any] struct {
+	Interval time.Duration
+	stop     chan bool
+	stopOnce sync.Once
+}
+
+// Stop signals the janitor goroutine to exit. Like janitor.Stop, it is safe
+// to call more than once.
+func (j *shardedJanitor[K, T]) Stop() {
+	j.stopOnce.Do(func() {
+		close(j.stop)
+	})
+}
+
+func (j *shardedJanitor[K, T]) Run(sc *shardedCache[K, T]) {
+	ticker := time.NewTicker(j.Interval)
+	interval := j.Interval
+	adaptive := sc.cs[0].adaptive
+	for {
+		select {
+		case <-ticker.C:
+			if adaptive == nil {
+				for _, c := range sc.cs {
+					c.sweep()
+				}
+				continue
+			}
+			var expired, total int
+			for _, c := range sc.cs {
+				e, n := c.sweepCounting()
+				expired += e
+				total += n
+			}
+			if d := adaptive.next(interval, expired, total); d != interval {
+				interval = d
+				ticker.Reset(interval)
+			}
+		case <-j.stop:
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+func stopShardedJanitor[K comparable, T any](sc *ShardedCache[K, T]) {
+	if j := sc.janitor; j != nil {
+		j.Stop()
+	}
+}
+
+// Close stops the janitor goroutine (if one was started) and clears the
+// finalizer set by NewSharded(). Close is idempotent, and the cache remains
+// safe to use after it has been closed. See Cache.Close.
+func (sc *ShardedCache[K, T]) Close() {
+	sc.closeOnce.Do(func() {
+		runtime.SetFinalizer(sc, nil)
+		stopShardedJanitor(sc)
+		for _, c := range sc.cs {
+			c.stopWorkers(true)
+		}
+	})
+}
+
+// finalizeSharded stops the goroutines started for sc once sc is unreachable.
+func finalizeSharded[K comparable, T any](sc *ShardedCache[K, T]) {
+	stopShardedJanitor(sc)
+	for _, c := range sc.cs {
+		c.stopWorkers(false)
+	}
+}
+
+func runShardedJanitor[K comparable, T any](sc *shardedCache[K, T], ci time.Duration) {
+	if a := sc.cs[0].adaptive; a != nil {
+		ci = a.clamp(ci)
+	}
+	j := &shardedJanitor[K, T]{
+		Interval: ci,
+		stop:     make(chan bool),
+	}
+	sc.janitor = j
+	go j.Run(sc)
+}
+
+// NewSharded returns a new cache whose items are spread across the given
+// number of shards (at least one), each protected by its own lock. The default
+// expiration duration and cleanup interval have the same meaning as for New().
+//
+// hasher maps a key to the shard it belongs to; if it is nil, NewHasher[K]()
+// is used. Any options are applied to each shard individually, so e.g. a
+// WithMaxItems limit applies per shard rather than to the whole cache.
+func NewSharded[K comparable, T any](defaultExpiration, cleanupInterval time.Duration, shards int, hasher func(K) uint64, opts ...Option[K, T]) *ShardedCache[K, T] {
+	if shards < 1 {
+		shards = 1
+	}
+	if hasher == nil {
+		hasher = NewHasher[K]()
+	}
+	sc := &shardedCache[K, T]{
+		hasher: hasher,
+		cs:     make([]*cache[K, T], shards),
+	}
+	for i := range sc.cs {
+		sc.cs[i] = newCache[K, T](defaultExpiration, make(map[K]Item[T]), opts...)
+	}
+	SC := &ShardedCache[K, T]{sc}
+	if sc.cs[0].noJanitor {
+		cleanupInterval = 0
+	}
+	if cleanupInterval > 0 {
+		runShardedJanitor(sc, cleanupInterval)
+	}
+	if cleanupInterval > 0 || sc.cs[0].hasWorkers() {
+		runtime.SetFinalizer(SC, finalizeSharded[K, T])
+	}
+	return SC
+}
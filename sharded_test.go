@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var shardedKeys = []string{
+	"f",
+	"fo",
+	"foo",
+	"barf",
+	"barfo",
+	"foobar",
+	"bazbarf",
+	"bazbarfo",
+	"bazbarfoo",
+	"foobarbazq",
+	"foobarbazqu",
+	"foobarbazquu",
+	"foobarbazquux",
+}
+
+func TestShardedCache(t *testing.T) {
+	tc := NewSharded[string, string](DefaultExpiration, 0, 13, nil)
+	for _, v := range shardedKeys {
+		tc.Set(v, "value", DefaultExpiration)
+	}
+	for _, v := range shardedKeys {
+		x, found := tc.Get(v)
+		assert.True(t, found, "%s was not found", v)
+		assert.Equal(t, "value", x)
+	}
+	assert.Equal(t, len(shardedKeys), tc.ItemCount())
+	assert.ElementsMatch(t, shardedKeys, tc.Keys())
+	assert.Len(t, tc.Items(), len(shardedKeys))
+
+	assert.Error(t, tc.Add("foo", "bar", DefaultExpiration))
+	assert.NoError(t, tc.Replace("foo", "bar", DefaultExpiration))
+	tc.Delete("foo")
+	_, found := tc.Get("foo")
+	assert.False(t, found, "foo was not deleted")
+
+	tc.Flush()
+	assert.Equal(t, 0, tc.ItemCount())
+}
+
+func TestShardedCacheExpiration(t *testing.T) {
+	tc := NewSharded[int, int](DefaultExpiration, time.Millisecond, 4, nil)
+	defer tc.Close()
+	var mu sync.Mutex
+	evicted := 0
+	tc.OnEvicted(func(k, v int) {
+		mu.Lock()
+		evicted++
+		mu.Unlock()
+	})
+	for i := 0; i < 100; i++ {
+		tc.Set(i, i, 5*time.Millisecond)
+	}
+	<-time.After(20 * time.Millisecond)
+	assert.Equal(t, 0, tc.ItemCount())
+	mu.Lock()
+	assert.Equal(t, 100, evicted)
+	mu.Unlock()
+}
+
+func TestShardedCacheHasher(t *testing.T) {
+	tc := NewSharded[int, int](DefaultExpiration, 0, 4, func(k int) uint64 {
+		return uint64(k)
+	})
+	for i := 0; i < 8; i++ {
+		tc.Set(i, i, DefaultExpiration)
+	}
+	for _, c := range tc.cs {
+		assert.Equal(t, 2, c.ItemCount())
+	}
+	tc.Close()
+	tc.Close()
+}
+
+func TestNewHasher(t *testing.T) {
+	negZero := math.Copysign(0, -1)
+	hf := NewHasher[float64]()
+	assert.Equal(t, hf(0), hf(negZero))
+	assert.NotEqual(t, hf(1), hf(2))
+	hf32 := NewHasher[float32]()
+	assert.Equal(t, hf32(0), hf32(float32(negZero)))
+
+	h8 := NewHasher[int8]()
+	assert.NotEqual(t, h8(1), h8(2))
+	hu16 := NewHasher[uint16]()
+	assert.Equal(t, hu16(7), hu16(7))
+	assert.NotEqual(t, hu16(1), hu16(2))
+
+	tc := NewSharded[float64, int](DefaultExpiration, 0, 8, nil)
+	tc.Set(negZero, 1, DefaultExpiration)
+	v, found := tc.Get(0)
+	assert.True(t, found)
+	assert.Equal(t, 1, v)
+}
+
+func BenchmarkShardedCacheGetExpiring(b *testing.B) {
+	benchmarkShardedCacheGet(b, 5*time.Minute)
+}
+
+func BenchmarkShardedCacheGetNotExpiring(b *testing.B) {
+	benchmarkShardedCacheGet(b, NoExpiration)
+}
+
+func benchmarkShardedCacheGet(b *testing.B, exp time.Duration) {
+	b.StopTimer()
+	tc := NewSharded[string, string](exp, 0, 10, nil)
+	tc.Set("foobarba", "zquux", DefaultExpiration)
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		tc.Get("foobarba")
+	}
+}
+
+func BenchmarkShardedCacheGetManyConcurrentExpiring(b *testing.B) {
+	benchmarkShardedCacheGetManyConcurrent(b, 5*time.Minute)
+}
+
+func BenchmarkShardedCacheGetManyConcurrentNotExpiring(b *testing.B) {
+	benchmarkShardedCacheGetManyConcurrent(b, NoExpiration)
+}
+
+func benchmarkShardedCacheGetManyConcurrent(b *testing.B, exp time.Duration) {
+	b.StopTimer()
+	n := 10000
+	tsc := NewSharded[string, string](exp, 0, 20, nil)
+	keys := make([]string, n)
+	for i := 0; i < n; i++ {
+		k := "foo" + strconv.Itoa(i)
+		keys[i] = k
+		tsc.Set(k, "bar", DefaultExpiration)
+	}
+	each := b.N / n
+	wg := new(sync.WaitGroup)
+	wg.Add(n)
+	for _, v := range keys {
+		go func(k string) {
+			for j := 0; j < each; j++ {
+				tsc.Get(k)
+			}
+			wg.Done()
+		}(v)
+	}
+	b.StartTimer()
+	wg.Wait()
+}
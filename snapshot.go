@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// snapshotter periodically saves the items of a cache created with
+// WithPeriodicSnapshot to a file.
+type snapshotter[K comparable, T any] struct {
+	fname    string
+	interval time.Duration
+	onError  func(error)
+	stopCh   chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newSnapshotter[K comparable, T any](fname string, interval time.Duration, onError func(error)) *snapshotter[K, T] {
+	return &snapshotter[K, T]{
+		fname:    fname,
+		interval: interval,
+		onError:  onError,
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// run saves the items of c every interval until stopped, and once more when
+// stopped.
+func (s *snapshotter[K, T]) run(c *cache[K, T]) {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.save(c)
+		case <-s.stopCh:
+			s.save(c)
+			return
+		}
+	}
+}
+
+// stop stops the goroutine started by run, waiting for its last save if wait
+// is true. It may be called more than once.
+func (s *snapshotter[K, T]) stop(wait bool) {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+	if wait {
+		<-s.done
+	}
+}
+
+// save writes a snapshot of c and reports an error to onError.
+func (s *snapshotter[K, T]) save(c *cache[K, T]) {
+	if err := c.saveSnapshot(s.fname); err != nil && s.onError != nil {
+		s.onError(err)
+	}
+}
+
+// saveSnapshot writes the unexpired items of c to fname like SaveFile. The
+// file is replaced atomically, so a reader never sees a partially written
+// snapshot.
+func (c *cache[K, T]) saveSnapshot(fname string) error {
+	fp, err := os.CreateTemp(filepath.Dir(fname), filepath.Base(fname)+".tmp*")
+	if err != nil {
+		return err
+	}
+	err = c.save(fp, true)
+	if err == nil {
+		err = fp.Close()
+	} else {
+		_ = fp.Close()
+	}
+	if err == nil {
+		err = os.Rename(fp.Name(), fname)
+	}
+	if err != nil {
+		_ = os.Remove(fp.Name())
+	}
+	return err
+}
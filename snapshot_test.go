@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithPeriodicSnapshot(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.gob")
+	tc := New[string, int](DefaultExpiration, 0,
+		WithPeriodicSnapshot[string, int](fname, 5*time.Millisecond, func(err error) {
+			t.Error(err)
+		}))
+	tc.Set("a", 1, DefaultExpiration)
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(fname)
+		return err == nil
+	}, 5*time.Second, time.Millisecond, "no snapshot was written")
+
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("expired", 3, time.Nanosecond)
+	tc.Close()
+	oc := New[string, int](DefaultExpiration, 0)
+	assert.NoError(t, oc.LoadFile(fname))
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, oc.GetMany([]string{"a", "b", "expired"}))
+	matches, _ := filepath.Glob(fname + ".tmp*")
+	assert.Empty(t, matches, "temporary files were left behind")
+}
+
+func TestWithPeriodicSnapshotError(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "missing", "cache.gob")
+	errs := make(chan error, 1)
+	tc := New[string, int](DefaultExpiration, 0,
+		WithPeriodicSnapshot[string, int](fname, time.Hour, func(err error) {
+			errs <- err
+		}))
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Close()
+	select {
+	case err := <-errs:
+		assert.Error(t, err)
+	default:
+		t.Error("the error of the final snapshot wasn't reported")
+	}
+}
@@ -0,0 +1,118 @@
+package cache
+
+import "sync/atomic"
+
+// Stats is a point-in-time snapshot of a cache's counters.
+type Stats struct {
+	// Hits is the number of Get calls that found an unexpired item.
+	Hits uint64
+	// Misses is the number of Get calls that found no item, or an expired one.
+	Misses uint64
+	// Evictions is the number of items removed by Delete, GetAndDelete,
+	// CompareAndDelete, SetNegative, PopN and DeleteFunc, or evicted to keep
+	// the cache within the limits set with WithMaxItems or WithMaxBytes, or
+	// under heap pressure (see WithHeapPressureEviction). Items removed by
+	// DeleteExpired, Flush or FlushWithEvict aren't counted.
+	Evictions uint64
+	// Expirations is the number of expired items removed by DeleteExpired.
+	Expirations uint64
+	// DroppedEvents is the number of events that weren't delivered because a
+	// subscriber's channel was full. See Subscribe.
+	DroppedEvents uint64
+	// DroppedExpirations is the number of expired items that weren't sent on
+	// the channel returned by ExpirationChannel because it was full.
+	DroppedExpirations uint64
+	// ItemCount is the number of items in the cache, as returned by ItemCount.
+	ItemCount int
+	// UniqueValues is the number of distinct values among the items in the
+	// cache, estimated by their hashes, for a cache created with
+	// WithValueHasher, and 0 otherwise. Like ItemCount, it may include
+	// expired items that haven't been deleted yet.
+	UniqueValues int
+	// LoaderRunning is the number of calls to the loader set with
+	// WithLoader that are running, for a cache created with
+	// WithLoaderConcurrency, and 0 otherwise.
+	LoaderRunning int
+	// LoaderQueued is the number of loads waiting for one of the running
+	// loads to finish, for a cache created with WithLoaderConcurrency, and 0
+	// otherwise.
+	LoaderQueued int
+	// WriteBehindFailures is the number of calls to the flush function set
+	// with WithWriteBehind that returned an error.
+	WriteBehindFailures uint64
+}
+
+// stats holds the counters behind Stats. They are only accessed atomically,
+// so they can be updated without holding the cache's lock.
+type stats struct {
+	hits                uint64
+	misses              uint64
+	evictions           uint64
+	expirations         uint64
+	droppedEvents       uint64
+	droppedExpirations  uint64
+	writeBehindFailures uint64
+}
+
+// Stats returns a snapshot of the cache's counters. The counters are read
+// individually, so under concurrent use they may be slightly inconsistent with
+// one another.
+func (c *cache[K, T]) Stats() Stats {
+	running, queued := c.loaderQueue()
+	return Stats{
+		Hits:                atomic.LoadUint64(&c.stats.hits),
+		Misses:              atomic.LoadUint64(&c.stats.misses),
+		Evictions:           atomic.LoadUint64(&c.stats.evictions),
+		Expirations:         atomic.LoadUint64(&c.stats.expirations),
+		DroppedEvents:       atomic.LoadUint64(&c.stats.droppedEvents),
+		DroppedExpirations:  atomic.LoadUint64(&c.stats.droppedExpirations),
+		ItemCount:           c.ItemCount(),
+		UniqueValues:        c.uniqueValues(),
+		LoaderRunning:       running,
+		LoaderQueued:        queued,
+		WriteBehindFailures: atomic.LoadUint64(&c.stats.writeBehindFailures),
+	}
+}
+
+// ResetStats sets all of the cache's counters back to zero. This is useful for
+// sampling the counters periodically.
+func (c *cache[K, T]) ResetStats() {
+	atomic.StoreUint64(&c.stats.hits, 0)
+	atomic.StoreUint64(&c.stats.misses, 0)
+	atomic.StoreUint64(&c.stats.evictions, 0)
+	atomic.StoreUint64(&c.stats.expirations, 0)
+	atomic.StoreUint64(&c.stats.droppedEvents, 0)
+	atomic.StoreUint64(&c.stats.droppedExpirations, 0)
+	atomic.StoreUint64(&c.stats.writeBehindFailures, 0)
+}
+
+// MetricsObserver is notified of every cache hit, miss and eviction, e.g. to
+// feed them into the counters of a metrics library without polling Stats. See
+// WithMetricsObserver.
+type MetricsObserver[K comparable] interface {
+	// OnHit is called when a read finds an unexpired item for k.
+	OnHit(k K)
+	// OnMiss is called when a read finds no item for k, or an expired one.
+	OnMiss(k K)
+	// OnEviction is called when the item for k is removed from the cache or
+	// overwritten, with the reason why.
+	OnEviction(k K, reason EvictReason)
+}
+
+// hit counts a hit for k. It must be called without holding c.mu.
+func (c *cache[K, T]) hit(k K) {
+	atomic.AddUint64(&c.stats.hits, 1)
+	c.logRead(k, true)
+	if c.observer != nil {
+		c.observer.OnHit(k)
+	}
+}
+
+// miss counts a miss for k. It must be called without holding c.mu.
+func (c *cache[K, T]) miss(k K) {
+	atomic.AddUint64(&c.stats.misses, 1)
+	c.logRead(k, false)
+	if c.observer != nil {
+		c.observer.OnMiss(k)
+	}
+}
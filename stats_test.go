@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	tc := New[string, int](DefaultExpiration, 0)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, time.Millisecond)
+
+	tc.Get("a")
+	tc.Get("a")
+	tc.Get("missing")
+	tc.Delete("b")
+	tc.Delete("missing")
+	<-time.After(2 * time.Millisecond)
+	tc.Get("c")
+	tc.DeleteExpired()
+
+	assert.Equal(t, Stats{
+		Hits:        2,
+		Misses:      2,
+		Evictions:   1,
+		Expirations: 1,
+		ItemCount:   1,
+	}, tc.Stats())
+
+	tc.ResetStats()
+	assert.Equal(t, Stats{ItemCount: 1}, tc.Stats())
+}
+
+type recordingObserver struct {
+	mu        sync.Mutex
+	hits      []string
+	misses    []string
+	evictions map[string]EvictReason
+}
+
+func (o *recordingObserver) OnHit(k string) {
+	o.mu.Lock()
+	o.hits = append(o.hits, k)
+	o.mu.Unlock()
+}
+
+func (o *recordingObserver) OnMiss(k string) {
+	o.mu.Lock()
+	o.misses = append(o.misses, k)
+	o.mu.Unlock()
+}
+
+func (o *recordingObserver) OnEviction(k string, reason EvictReason) {
+	o.mu.Lock()
+	o.evictions[k] = reason
+	o.mu.Unlock()
+}
+
+func TestWithMetricsObserver(t *testing.T) {
+	o := &recordingObserver{evictions: map[string]EvictReason{}}
+	tc := New[string, int](DefaultExpiration, 0, WithMetricsObserver[string, int](o))
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, time.Millisecond)
+
+	tc.Get("a")
+	tc.Get("missing")
+	tc.GetMany([]string{"a", "b", "nope"})
+	tc.GetSliding("b")
+	assert.Equal(t, []string{"a", "a", "b", "b"}, o.hits)
+	assert.Equal(t, []string{"missing", "nope"}, o.misses)
+
+	tc.Delete("a")
+	tc.Set("b", 3, DefaultExpiration)
+	<-time.After(2 * time.Millisecond)
+	tc.DeleteExpired()
+	assert.Equal(t, map[string]EvictReason{
+		"a": Deleted,
+		"b": Replaced,
+		"c": Expired,
+	}, o.evictions)
+}
+
+func TestWithValueHasher(t *testing.T) {
+	hash := func(v string) uint64 {
+		h := uint64(14695981039346656037)
+		for i := 0; i < len(v); i++ {
+			h ^= uint64(v[i])
+			h *= 1099511628211
+		}
+		return h
+	}
+	tc := New[string, string](NoExpiration, 0, WithValueHasher[string, string](hash))
+	tc.Set("a", "x", DefaultExpiration)
+	tc.Set("b", "x", DefaultExpiration)
+	tc.Set("c", "y", DefaultExpiration)
+	assert.Equal(t, 2, tc.Stats().UniqueValues)
+
+	tc.Set("c", "x", DefaultExpiration)
+	assert.Equal(t, 1, tc.Stats().UniqueValues)
+
+	tc.Set("d", "z", DefaultExpiration)
+	tc.Delete("a")
+	tc.Delete("b")
+	assert.Equal(t, 2, tc.Stats().UniqueValues)
+
+	tc.Flush()
+	assert.Equal(t, 0, tc.Stats().UniqueValues)
+
+	tc.SwapItems(map[string]Item[string]{"e": {Object: "w"}, "f": {Object: "w"}}, false)
+	assert.Equal(t, 1, tc.Stats().UniqueValues)
+
+	assert.Equal(t, 0, New[string, string](NoExpiration, 0).Stats().UniqueValues)
+}
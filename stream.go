@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// KeyValue is a key and the value stored under it.
+type KeyValue[K comparable, T any] struct {
+	Key   K
+	Value T
+}
+
+// loadBatchSize is the largest number of items LoadFromChannel stores while
+// holding the cache's lock.
+const loadBatchSize = 1024
+
+// LoadFromChannel stores the items received from ch with the duration d (see
+// Set for the meaning of d) until ch is closed, and returns the number of
+// items stored. Items that are already waiting in ch are stored in batches,
+// acquiring the cache's lock only once per batch as SetMany does, so the
+// items don't have to be collected in a map first. As with Set, existing
+// items are replaced.
+//
+// If ctx is done before ch is closed, LoadFromChannel stops receiving and
+// returns the number of items stored so far together with ctx.Err(). Items
+// that were received before are stored.
+func (c *cache[K, T]) LoadFromChannel(ctx context.Context, ch <-chan KeyValue[K, T], d time.Duration) (int, error) {
+	n := 0
+	batch := make([]KeyValue[K, T], 0, loadBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		c.setEach(d, func(set func(K, T)) {
+			for _, kv := range batch {
+				set(kv.Key, kv.Value)
+			}
+		})
+		n += len(batch)
+		batch = batch[:0]
+	}
+	for {
+		// Wait for the next item, then take whatever else is ready
+		select {
+		case kv, ok := <-ch:
+			if !ok {
+				return n, nil
+			}
+			batch = append(batch, kv)
+		case <-ctx.Done():
+			return n, ctx.Err()
+		}
+	drain:
+		for len(batch) < loadBatchSize {
+			select {
+			case kv, ok := <-ch:
+				if !ok {
+					flush()
+					return n, nil
+				}
+				batch = append(batch, kv)
+			default:
+				break drain
+			}
+		}
+		flush()
+	}
+}
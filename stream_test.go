@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadFromChannel(t *testing.T) {
+	tc := New[int, int](DefaultExpiration, 0)
+	tc.Set(0, -1, DefaultExpiration)
+	ch := make(chan KeyValue[int, int], 100)
+	go func() {
+		for i := 0; i < 3000; i++ {
+			ch <- KeyValue[int, int]{i, i}
+		}
+		close(ch)
+	}()
+	n, err := tc.LoadFromChannel(context.Background(), ch, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 3000, n)
+	assert.Equal(t, 3000, tc.ItemCount())
+	x, _, found := tc.GetWithExpiration(0)
+	assert.True(t, found)
+	assert.Equal(t, 0, x, "existing item wasn't replaced")
+	_, exp, _ := tc.GetWithExpiration(2999)
+	assert.False(t, exp.IsZero())
+}
+
+func TestLoadFromChannelCanceled(t *testing.T) {
+	tc := New[int, int](DefaultExpiration, 0)
+	ch := make(chan KeyValue[int, int])
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ch <- KeyValue[int, int]{1, 1}
+		ch <- KeyValue[int, int]{2, 2}
+		cancel()
+	}()
+	n, err := tc.LoadFromChannel(ctx, ch, DefaultExpiration)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 2, tc.ItemCount())
+}
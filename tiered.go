@@ -0,0 +1,113 @@
+package cache
+
+import "time"
+
+// L2 is a second, slower cache tier, such as Redis, that a Tiered cache
+// consults when an item isn't in memory. Implementations must be safe for
+// concurrent use.
+type L2[K comparable, T any] interface {
+	// Get returns the value stored for k and whether it was found. A
+	// missing or expired item is reported as not found, not as an error.
+	Get(k K) (T, bool, error)
+	// Set stores x for k for the duration d, which is never
+	// DefaultExpiration. NoExpiration means the item must not expire.
+	Set(k K, x T, d time.Duration) error
+	// Delete deletes the item for k, if there is one.
+	Delete(k K) error
+}
+
+// Tiered is a two-tier cache: a Cache that holds the items in memory (L1),
+// in front of a slower L2 that holds them elsewhere. Reads are served by L1 if
+// possible, and by L2 otherwise; writes go to both.
+type Tiered[K comparable, T any] struct {
+	l1 *Cache[K, T]
+	l2 L2[K, T]
+	// promoteTTL is the duration items read from L2 are stored in L1 for.
+	promoteTTL time.Duration
+	// l2TTL is the duration items are written to L2 for, or
+	// DefaultExpiration to use the duration they're written to L1 for.
+	l2TTL time.Duration
+}
+
+// TieredOption configures a Tiered cache.
+type TieredOption[K comparable, T any] func(*Tiered[K, T])
+
+// WithPromotionExpiration sets the duration for which items that are read
+// from L2, because they weren't in L1, are stored in L1 (see Set for the
+// meaning of d). By default, it is the L1 cache's default expiration. Since
+// the L2 interface doesn't report how long an item has left, an item may live
+// on in L1 after it expired in L2, for up to d, so d should be short for
+// items that must not outlive their L2 expiration.
+func WithPromotionExpiration[K comparable, T any](d time.Duration) TieredOption[K, T] {
+	return func(t *Tiered[K, T]) {
+		t.promoteTTL = d
+	}
+}
+
+// WithL2Expiration makes Set write items to L2 with the duration d, e.g. to
+// keep them longer in L2 than in L1, rather than with the duration they're
+// written to L1 with. It has no effect if d is DefaultExpiration.
+func WithL2Expiration[K comparable, T any](d time.Duration) TieredOption[K, T] {
+	return func(t *Tiered[K, T]) {
+		t.l2TTL = d
+	}
+}
+
+// NewTiered returns a cache that uses l1 as its in-memory tier in front of l2.
+// l1 should only be modified through the returned cache, or L1 and L2 may
+// diverge; reading from it directly is fine.
+func NewTiered[K comparable, T any](l1 *Cache[K, T], l2 L2[K, T], opts ...TieredOption[K, T]) *Tiered[K, T] {
+	t := &Tiered[K, T]{
+		l1:         l1,
+		l2:         l2,
+		promoteTTL: DefaultExpiration,
+		l2TTL:      DefaultExpiration,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Get returns the item for k from L1 if it is there and hasn't expired, and
+// otherwise from L2, in which case it is stored in L1 for the duration set
+// with WithPromotionExpiration. It returns false if the item is in neither
+// tier, and the error returned by L2, if any.
+func (t *Tiered[K, T]) Get(k K) (T, bool, error) {
+	if v, found := t.l1.Get(k); found {
+		return v, true, nil
+	}
+	v, found, err := t.l2.Get(k)
+	if err != nil || !found {
+		return *new(T), false, err
+	}
+	t.l1.Set(k, v, t.promoteTTL)
+	return v, true, nil
+}
+
+// Set stores x for k in L1 with the duration d (see Cache.Set), and then in
+// L2, with the same duration unless WithL2Expiration was used, and returns
+// the error returned by L2, if any. If L2 fails, the item stays in L1.
+func (t *Tiered[K, T]) Set(k K, x T, d time.Duration) error {
+	t.l1.Set(k, x, d)
+	d2 := t.l2TTL
+	if d2 == DefaultExpiration {
+		d2 = t.l1.duration(d)
+	}
+	if d2 <= 0 {
+		d2 = NoExpiration
+	}
+	return t.l2.Set(k, x, d2)
+}
+
+// Delete deletes the item for k from both tiers, and returns the error
+// returned by L2, if any.
+func (t *Tiered[K, T]) Delete(k K) error {
+	t.l1.Delete(k)
+	return t.l2.Delete(k)
+}
+
+// L1 returns the in-memory tier, e.g. to read its Stats.
+func (t *Tiered[K, T]) L1() *Cache[K, T] {
+	return t.l1
+}
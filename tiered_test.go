@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mapL2 is an L2 backed by a map, which records the durations it was given.
+type mapL2 struct {
+	mu    sync.Mutex
+	items map[string]int
+	ttls  map[string]time.Duration
+	err   error
+}
+
+func newMapL2() *mapL2 {
+	return &mapL2{items: map[string]int{}, ttls: map[string]time.Duration{}}
+}
+
+func (m *mapL2) Get(k string) (int, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return 0, false, m.err
+	}
+	v, found := m.items[k]
+	return v, found, nil
+}
+
+func (m *mapL2) Set(k string, x int, d time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.items[k] = x
+	m.ttls[k] = d
+	return nil
+}
+
+func (m *mapL2) Delete(k string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, k)
+	return m.err
+}
+
+func TestTiered(t *testing.T) {
+	l1 := New[string, int](time.Minute, 0)
+	l2 := newMapL2()
+	tc := NewTiered[string, int](l1, l2)
+
+	assert.NoError(t, tc.Set("a", 1, DefaultExpiration))
+	assert.NoError(t, tc.Set("b", 2, NoExpiration))
+	assert.Equal(t, 1, l2.items["a"])
+	assert.Equal(t, time.Minute, l2.ttls["a"])
+	assert.Equal(t, NoExpiration, l2.ttls["b"])
+
+	// An item only in L2 is promoted into L1
+	l2.items["c"] = 3
+	v, found, err := tc.Get("c")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 3, v)
+	v, found = l1.Get("c")
+	assert.True(t, found)
+	assert.Equal(t, 3, v)
+
+	_, found, err = tc.Get("missing")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.NoError(t, tc.Delete("a"))
+	_, found, _ = tc.Get("a")
+	assert.False(t, found)
+	assert.NotContains(t, l2.items, "a")
+
+	errDown := errors.New("down")
+	l2.err = errDown
+	_, _, err = tc.Get("missing")
+	assert.ErrorIs(t, err, errDown)
+	assert.ErrorIs(t, tc.Set("d", 4, DefaultExpiration), errDown)
+	assert.True(t, l1.Contains("d"))
+}
+
+func TestTieredExpiration(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	l1 := New[string, int](time.Minute, 0, WithClock[string, int](clock))
+	l2 := newMapL2()
+	tc := NewTiered[string, int](l1, l2,
+		WithPromotionExpiration[string, int](time.Second),
+		WithL2Expiration[string, int](time.Hour))
+
+	assert.NoError(t, tc.Set("a", 1, DefaultExpiration))
+	assert.Equal(t, time.Hour, l2.ttls["a"])
+
+	l2.items["b"] = 2
+	_, _, _ = tc.Get("b")
+	_, exp, found := l1.GetWithExpiration("b")
+	assert.True(t, found)
+	assert.True(t, exp.Equal(clock.Now().Add(time.Second)))
+	assert.Same(t, l1, tc.L1())
+}
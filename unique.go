@@ -0,0 +1,47 @@
+package cache
+
+// valueCounts counts the items of a cache created with WithValueHasher by the
+// hash of their values. It is protected by the cache's mu.
+type valueCounts[T any] struct {
+	hash   func(T) uint64
+	counts map[uint64]int
+}
+
+func newValueCounts[T any](hash func(T) uint64) *valueCounts[T] {
+	return &valueCounts[T]{
+		hash:   hash,
+		counts: make(map[uint64]int),
+	}
+}
+
+// add counts a stored value.
+func (vc *valueCounts[T]) add(x T) {
+	vc.counts[vc.hash(x)]++
+}
+
+// remove stops counting a value that is no longer stored.
+func (vc *valueCounts[T]) remove(x T) {
+	h := vc.hash(x)
+	if vc.counts[h] <= 1 {
+		delete(vc.counts, h)
+	} else {
+		vc.counts[h]--
+	}
+}
+
+// reset forgets all values.
+func (vc *valueCounts[T]) reset() {
+	vc.counts = make(map[uint64]int)
+}
+
+// uniqueValues returns the number of distinct value hashes among the items in
+// the cache, or 0 if the cache wasn't created with WithValueHasher.
+func (c *cache[K, T]) uniqueValues() int {
+	if c.values == nil {
+		return 0
+	}
+	c.mu.RLock()
+	n := len(c.values.counts)
+	c.mu.RUnlock()
+	return n
+}
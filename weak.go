@@ -0,0 +1,41 @@
+//go:build go1.24
+
+package cache
+
+import (
+	"time"
+	"weak"
+)
+
+// SetWeak stores a weak pointer to v under k with the expiration duration d
+// (see Set). Unlike a value stored with Set, v doesn't keep what it points to
+// alive: once nothing else references it, the garbage collector may reclaim
+// it before the item expires, after which GetWeak no longer finds it. This
+// bounds the memory held by a cache of large objects by what the rest of the
+// program uses, in addition to the expiration time.
+//
+// SetWeak requires Go 1.24 or later.
+func SetWeak[K comparable, V any](c *Cache[K, weak.Pointer[V]], k K, v *V, d time.Duration) {
+	c.Set(k, weak.Make(v), d)
+}
+
+// GetWeak gets the value stored under k with SetWeak. It returns nil and false
+// if the item doesn't exist, has expired, or its value has been reclaimed by
+// the garbage collector, in which case the item is deleted as with Delete.
+// A reclaimed value still counts as a hit in Stats.
+//
+// GetWeak requires Go 1.24 or later.
+func GetWeak[K comparable, V any](c *Cache[K, weak.Pointer[V]], k K) (*V, bool) {
+	p, found := c.Get(k)
+	if !found {
+		return nil, false
+	}
+	v := p.Value()
+	if v == nil {
+		c.CompareAndDelete(k, p, func(a, b weak.Pointer[V]) bool {
+			return a == b
+		})
+		return nil, false
+	}
+	return v, true
+}
@@ -0,0 +1,33 @@
+//go:build go1.24
+
+package cache
+
+import (
+	"runtime"
+	"testing"
+	"weak"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type weakTestValue struct {
+	buf [1024]byte
+}
+
+func TestSetWeak(t *testing.T) {
+	tc := New[string, weak.Pointer[weakTestValue]](DefaultExpiration, 0)
+	kept := &weakTestValue{}
+	SetWeak(tc, "kept", kept, DefaultExpiration)
+	SetWeak(tc, "dropped", &weakTestValue{}, DefaultExpiration)
+
+	runtime.GC()
+	v, found := GetWeak(tc, "kept")
+	assert.True(t, found)
+	assert.Same(t, kept, v)
+	_, found = GetWeak(tc, "dropped")
+	assert.False(t, found, "value wasn't reclaimed")
+	assert.Equal(t, 1, tc.ItemCount(), "reclaimed item wasn't deleted")
+	_, found = GetWeak(tc, "missing")
+	assert.False(t, found)
+	runtime.KeepAlive(kept)
+}
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxWriteBehindBackoff limits how many intervals the write-behind goroutine
+// waits before retrying after consecutive failed flushes.
+const maxWriteBehindBackoff = 32
+
+// writeBehind buffers the items written to and the keys deleted from a cache
+// created with WithWriteBehind until they are passed to flush.
+type writeBehind[K comparable, T any] struct {
+	flush    func(written map[K]T, deleted []K) error
+	interval time.Duration
+	// dirty holds the latest value of every key written since the last
+	// successful flush, and deleted every key deleted since then; a key is
+	// in at most one of them. Both are protected by the cache's mu.
+	dirty   map[K]T
+	deleted map[K]struct{}
+	// flushMu serializes flushes, so that a retry can't overtake a newer
+	// batch.
+	flushMu  sync.Mutex
+	stopCh   chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newWriteBehind[K comparable, T any](flush func(map[K]T, []K) error, interval time.Duration) *writeBehind[K, T] {
+	return &writeBehind[K, T]{
+		flush:    flush,
+		interval: interval,
+		dirty:    make(map[K]T),
+		deleted:  make(map[K]struct{}),
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// run flushes the dirty items of c every interval until stopped, backing off
+// exponentially while flushes fail, and flushes one last time when stopped.
+func (w *writeBehind[K, T]) run(c *cache[K, T]) {
+	defer close(w.done)
+	backoff := 1
+	timer := time.NewTimer(w.interval)
+	for {
+		select {
+		case <-timer.C:
+			if err := w.flushDirty(c); err != nil {
+				if backoff < maxWriteBehindBackoff {
+					backoff *= 2
+				}
+			} else {
+				backoff = 1
+			}
+			timer.Reset(time.Duration(backoff) * w.interval)
+		case <-w.stopCh:
+			timer.Stop()
+			_ = w.flushDirty(c)
+			return
+		}
+	}
+}
+
+// stop stops the goroutine started by run, waiting for its last flush if wait
+// is true. It may be called more than once.
+func (w *writeBehind[K, T]) stop(wait bool) {
+	w.stopOnce.Do(func() {
+		close(w.stopCh)
+	})
+	if wait {
+		<-w.done
+	}
+}
+
+// flushDirty passes the dirty items and deleted keys of c to flush. If flush
+// fails, they are marked dirty or deleted again, unless their keys have been
+// written or deleted again in the meantime, and the failure is counted in
+// Stats().WriteBehindFailures.
+func (w *writeBehind[K, T]) flushDirty(c *cache[K, T]) error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+	c.mu.Lock()
+	batch, deleted := w.dirty, w.deleted
+	if len(batch) == 0 && len(deleted) == 0 {
+		c.mu.Unlock()
+		return nil
+	}
+	w.dirty = make(map[K]T)
+	w.deleted = make(map[K]struct{})
+	c.mu.Unlock()
+	keys := make([]K, 0, len(deleted))
+	for k := range deleted {
+		keys = append(keys, k)
+	}
+	err := w.flush(batch, keys)
+	if err != nil {
+		atomic.AddUint64(&c.stats.writeBehindFailures, 1)
+		c.mu.Lock()
+		for k, v := range batch {
+			if !w.pending(k) {
+				w.dirty[k] = v
+			}
+		}
+		for k := range deleted {
+			if !w.pending(k) {
+				w.deleted[k] = struct{}{}
+			}
+		}
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// pending reports whether k has been written or deleted since the last
+// flush. The cache's mu must be held.
+func (w *writeBehind[K, T]) pending(k K) bool {
+	if _, found := w.dirty[k]; found {
+		return true
+	}
+	_, found := w.deleted[k]
+	return found
+}
+
+// markDirty records that x was written under k. c.mu must be held.
+func (c *cache[K, T]) markDirty(k K, x T) {
+	if c.writeBehind != nil {
+		delete(c.writeBehind.deleted, k)
+		c.writeBehind.dirty[k] = x
+	}
+}
+
+// forgetDirty records that the item stored under k was deleted, so that the
+// deletion, rather than the item, is flushed. c.mu must be held.
+func (c *cache[K, T]) forgetDirty(k K) {
+	if c.writeBehind != nil {
+		delete(c.writeBehind.dirty, k)
+		c.writeBehind.deleted[k] = struct{}{}
+	}
+}
+
+// FlushDirty immediately passes the items written and the keys deleted since
+// the last flush to the function set with WithWriteBehind, and returns its
+// error. It does nothing if
+// the cache wasn't created with WithWriteBehind, or has been closed.
+func (c *cache[K, T]) FlushDirty() error {
+	c.mu.RLock()
+	w := c.writeBehind
+	c.mu.RUnlock()
+	if w == nil {
+		return nil
+	}
+	return w.flushDirty(c)
+}
@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithWriteBehind(t *testing.T) {
+	var mu sync.Mutex
+	var flushed []map[string]int
+	var deletes [][]string
+	flush := func(m map[string]int, deleted []string) error {
+		mu.Lock()
+		flushed = append(flushed, m)
+		deletes = append(deletes, deleted)
+		mu.Unlock()
+		return nil
+	}
+	tc := New[string, int](DefaultExpiration, 0, WithWriteBehind[string, int](flush, time.Hour))
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("a", 2, DefaultExpiration)
+	tc.Set("b", 3, DefaultExpiration)
+	tc.Set("c", 4, DefaultExpiration)
+	tc.Delete("c")
+	assert.NoError(t, tc.FlushDirty())
+	assert.Equal(t, []map[string]int{{"a": 2, "b": 3}}, flushed)
+	assert.Equal(t, [][]string{{"c"}}, deletes)
+
+	assert.NoError(t, tc.FlushDirty())
+	assert.Len(t, flushed, 1, "nothing to flush")
+
+	// Deleting an item that was already flushed deletes it from the
+	// backing store, and writing it again undoes that
+	tc.Delete("a")
+	tc.Delete("b")
+	tc.Set("b", 4, DefaultExpiration)
+	tc.Set("d", 5, DefaultExpiration)
+	tc.Close()
+	assert.Equal(t, []map[string]int{{"a": 2, "b": 3}, {"b": 4, "d": 5}}, flushed)
+	assert.Equal(t, [][]string{{"c"}, {"a"}}, deletes)
+	assert.NoError(t, tc.FlushDirty())
+}
+
+func TestWithWriteBehindInterval(t *testing.T) {
+	flushed := make(chan map[string]int, 1)
+	tc := New[string, int](DefaultExpiration, 0, WithWriteBehind[string, int](func(m map[string]int, deleted []string) error {
+		flushed <- m
+		return nil
+	}, 10*time.Millisecond))
+	defer tc.Close()
+	tc.Set("a", 1, DefaultExpiration)
+	select {
+	case m := <-flushed:
+		assert.Equal(t, map[string]int{"a": 1}, m)
+	case <-time.After(5 * time.Second):
+		t.Fatal("items were not flushed")
+	}
+}
+
+func TestWithWriteBehindError(t *testing.T) {
+	errFlush := errors.New("unavailable")
+	var fail bool
+	var flushed map[string]int
+	var deletes []string
+	tc := New[string, int](DefaultExpiration, 0, WithWriteBehind[string, int](func(m map[string]int, deleted []string) error {
+		if fail {
+			return errFlush
+		}
+		flushed = m
+		deletes = deleted
+		return nil
+	}, time.Hour))
+	defer tc.Close()
+	fail = true
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Delete("c")
+	tc.Delete("d")
+	assert.ErrorIs(t, tc.FlushDirty(), errFlush)
+	assert.Equal(t, uint64(1), tc.Stats().WriteBehindFailures)
+
+	// A failed batch is retried, without overwriting newer changes.
+	fail = false
+	tc.Set("b", 3, DefaultExpiration)
+	tc.Set("d", 4, DefaultExpiration)
+	assert.NoError(t, tc.FlushDirty())
+	assert.Equal(t, map[string]int{"a": 1, "b": 3, "d": 4}, flushed)
+	assert.Equal(t, []string{"c"}, deletes)
+	assert.Equal(t, uint64(1), tc.Stats().WriteBehindFailures)
+}
+
+func TestWithWriteBehindEvicted(t *testing.T) {
+	var flushed map[string]int
+	tc := New[string, int](DefaultExpiration, 0,
+		WithMaxItems[string, int](1),
+		WithWriteBehind[string, int](func(m map[string]int, deleted []string) error {
+			flushed = m
+			return nil
+		}, time.Hour))
+	defer tc.Close()
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	assert.Equal(t, 1, tc.ItemCount())
+	assert.NoError(t, tc.FlushDirty())
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, flushed)
+}
+
+func TestShardedWithWriteBehind(t *testing.T) {
+	var mu sync.Mutex
+	flushed := map[string]int{}
+	sc := NewSharded[string, int](DefaultExpiration, 0, 4, nil, WithWriteBehind[string, int](func(m map[string]int, deleted []string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for k, v := range m {
+			flushed[k] = v
+		}
+		return nil
+	}, time.Hour))
+	sc.Set("a", 1, DefaultExpiration)
+	sc.Set("b", 2, DefaultExpiration)
+	sc.Set("c", 3, DefaultExpiration)
+	sc.Close()
+	assert.Equal(t, map[string]int{"a": 1, "b": 2, "c": 3}, flushed)
+}